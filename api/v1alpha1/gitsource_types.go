@@ -0,0 +1,108 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// GitSourceSpec defines the desired state of GitSource
+type GitSourceSpec struct {
+	// WebServer defines the name of the WebServer resource, that shall host the files of the repository
+	// +kubebuilder:validation:Required
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="WebServer resource"
+	WebServer string `json:"webserver,omitempty"`
+
+	// URL defines the git repository URL (https://, ssh:// or scp-like user@host:path)
+	// +kubebuilder:validation:Required
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Repository URL"
+	URL string `json:"url,omitempty"`
+
+	// Ref defines the branch or tag to check out, the default branch of the repository is used if empty
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Branch or tag"
+	Ref string `json:"ref,omitempty"`
+
+	// Directory defines the subdirectory of the repository to publish, the whole repository is published if empty
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Subdirectory"
+	Directory string `json:"directory,omitempty"`
+
+	// SecretRef defines the Secret with repository credentials, either 'username' and 'password' keys (HTTPS),
+	// or 'ssh-privatekey' and 'known_hosts' keys (SSH). The 'known_hosts' key is required for SSH repositories,
+	// the host key of the server is always verified.
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Credentials Secret"
+	SecretRef *corev1.LocalObjectReference `json:"secretRef,omitempty"`
+
+	// Interval defines how often the repository is polled for changes
+	// +kubebuilder:default="5m"
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Poll interval"
+	Interval metav1.Duration `json:"interval,omitempty"`
+
+	// Paused freezes the published files, the repository is not polled while paused
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Paused"
+	Paused bool `json:"paused,omitempty"`
+}
+
+// GitSourceStatus defines the observed state of GitSource
+type GitSourceStatus struct {
+	// Commit is the SHA of the published commit
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	Commit string `json:"commit,omitempty"`
+
+	// LastSyncTime is the time the repository was last fetched
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	LastSyncTime *metav1.Time `json:"lastSyncTime,omitempty"`
+
+	// Collisions lists the files, that are not published, because another file of the repository
+	// is published under the same page name (e.g. 'a/b.html' and 'a-b.html')
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	Collisions []string `json:"collisions,omitempty"`
+
+	// Conditions store the status conditions of the GitSource
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type" protobuf:"bytes,1,rep,name=conditions"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+
+// GitSource is the Schema for the gitsources API
+type GitSource struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   GitSourceSpec   `json:"spec,omitempty"`
+	Status GitSourceStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// GitSourceList contains a list of GitSource
+type GitSourceList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []GitSource `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&GitSource{}, &GitSourceList{})
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -24,27 +25,187 @@ import (
 // NOTE: json tags are required.  Any new fields you add must have json tags for the fields to be serialized.
 
 // PageSpec defines the desired state of Page
+// +kubebuilder:validation:XValidation:rule="!has(self.binary) || !has(self.contents)",message="binary and contents are mutually exclusive"
 type PageSpec struct {
-	// WebServer defines the name of the WebSever resource, that shall host the page
-	// +kubebuilder:validation:Required
+	// WebServer defines the name of the WebSever resource, that shall host the page.
+	// It may be omitted for pages selected by WebServer spec.pageSelector.
+	// +optional
 	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="WebServer resource"
 	WebServer string `json:"webserver,omitempty"`
 
-	// Name defines the name of the web page as displayed in index
+	// WebServerNamespace defines the namespace of the WebServer resource, defaults to the namespace of the page.
+	// Publishing into another namespace must be allowed by a PageGrant in that namespace.
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="WebServer namespace"
+	WebServerNamespace string `json:"webserverNamespace,omitempty"`
+
+	// Name defines the name of the web page as displayed in index, it is the file name the page is served as.
+	// Only letters, digits, '-', '_' and '.' are allowed, '.' and '..' are not valid names.
+	// NOTE: names with other characters were accepted by older versions, such pages must be renamed
+	// before they can be updated.
 	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MaxLength=253
+	// +kubebuilder:validation:Pattern=`^[-._a-zA-Z0-9]+$`
+	// +kubebuilder:validation:XValidation:rule="self != '.' && self != '..'",message="'.' and '..' are not valid page names"
 	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Page name in index"
 	Name string `json:"name,omitempty"`
 
+	// Title defines the human readable title of the page, it is available to page templates.
+	// Defaults to Name.
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Page title"
+	Title string `json:"title,omitempty"`
+
 	// Contents defines the HTML contents of the page
-	// +kubebuilder:validation:Required
 	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Web page contents"
 	Contents string `json:"contents,omitempty"`
+
+	// Template enables rendering of the contents as Go html/template. The data context contains
+	// .WebServer (Name, Namespace, Labels), .Page and .Pages (Name, Path, Title of the page and of all pages
+	// of the WebServer), .Variables (spec.variables of the WebServer) and .Year (the current year)
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Render contents as template"
+	Template bool `json:"template,omitempty"`
+
+	// Draft marks the page as work in progress, it is served only by the preview deployment
+	// of the WebServer (see WebServer spec.preview)
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Draft"
+	Draft bool `json:"draft,omitempty"`
+
+	// ContentsFrom defines a ConfigMap or Secret the contents of the page are taken from,
+	// it is published instead of Contents
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Web page contents source"
+	ContentsFrom *ContentsSource `json:"contentsFrom,omitempty"`
+
+	// Binary defines the base64 encoded contents of a binary asset (image, stylesheet, script, font),
+	// it can not be set together with Contents
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Binary asset contents"
+	Binary []byte `json:"binary,omitempty"`
+
+	// ContentType defines the MIME type the page is served with, for example 'image/png'.
+	// If not set, the type is derived from the page name extension.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^[-.+\w]+/[-.+\w]+$`
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Content type"
+	ContentType string `json:"contentType,omitempty"`
+
+	// ContentSecurityPolicy overrides the Content-Security-Policy header of the WebServer for the page,
+	// hashes of its inline scripts are added to it
+	// +optional
+	// +kubebuilder:validation:Pattern=`^[^"\\$\r\n]*$`
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Content-Security-Policy"
+	ContentSecurityPolicy string `json:"contentSecurityPolicy,omitempty"`
+
+	// ErrorCode marks the page as the error page of the WebServer for the given HTTP status code,
+	// for example 404. If several pages have the same code, the first one by name is used.
+	// +optional
+	// +kubebuilder:validation:Minimum=400
+	// +kubebuilder:validation:Maximum=599
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Error code"
+	ErrorCode int32 `json:"errorCode,omitempty"`
+
+	// PublishAt defines the time the page is published at, the page is not served before.
+	// If not set, the page is published immediately.
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Publish at"
+	PublishAt *metav1.Time `json:"publishAt,omitempty"`
+
+	// ExpireAt defines the time the page is withdrawn at, the page is not served afterwards.
+	// If not set, the page does not expire.
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Expire at"
+	ExpireAt *metav1.Time `json:"expireAt,omitempty"`
+
+	// Revision defines the revision (see status.revisions) to be published instead of the current contents,
+	// it is used to roll the page back. If not set, the current contents are published.
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Published revision"
+	Revision string `json:"revision,omitempty"`
+
+	// RevisionHistoryLimit defines the number of old revisions of the page to keep
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:default=10
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Revision history limit"
+	RevisionHistoryLimit *int32 `json:"revisionHistoryLimit,omitempty"`
+}
+
+// ContentsSource defines the source of the page contents, exactly one of the fields shall be set
+// +kubebuilder:validation:XValidation:rule="[has(self.configMapKeyRef), has(self.secretKeyRef), has(self.configMapRef)].filter(x, x).size() == 1",message="exactly one of configMapKeyRef, secretKeyRef and configMapRef must be set"
+type ContentsSource struct {
+	// ConfigMapKeyRef selects a key of a ConfigMap in the page namespace, its value is published as the page
+	// +optional
+	ConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
+
+	// SecretKeyRef selects a key of a Secret in the page namespace, its value is published as the page
+	// +optional
+	SecretKeyRef *corev1.SecretKeySelector `json:"secretKeyRef,omitempty"`
+
+	// ConfigMapRef imports a whole ConfigMap in the page namespace, each key is published as a separate file
+	// named after the key (the page name is not used)
+	// +optional
+	ConfigMapRef *ConfigMapReference `json:"configMapRef,omitempty"`
+}
+
+// ConfigMapReference selects a whole ConfigMap in the page namespace
+type ConfigMapReference struct {
+	corev1.LocalObjectReference `json:",inline"`
+
+	// Optional specifies whether the ConfigMap must exist, nothing is published if an optional ConfigMap is missing
+	// +optional
+	Optional *bool `json:"optional,omitempty"`
 }
 
 // PageStatus defines the observed state of Page
 type PageStatus struct {
-	// INSERT ADDITIONAL STATUS FIELD - define observed state of cluster
-	// Important: Run "make" to regenerate code after modifying this file
+	// Conditions store the status conditions of the Page
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type" protobuf:"bytes,1,rep,name=conditions"`
+
+	// PreviewURL is the URL of the page on the preview host of the WebServer (if the preview is enabled)
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=status,displayName="Preview URL"
+	PreviewURL string `json:"previewURL,omitempty"`
+
+	// Revision is the revision of the contents currently published
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=status,displayName="Current revision"
+	Revision string `json:"revision,omitempty"`
+
+	// Revisions lists the kept revisions of the page, the newest first
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=status,displayName="Revisions"
+	Revisions []PageRevision `json:"revisions,omitempty"`
+
+	// PublishedName is the page name last published, a Redirect from it is created when the page is renamed
+	// (see WebServer spec.autoRedirect)
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=status,displayName="Published name"
+	PublishedName string `json:"publishedName,omitempty"`
+
+	// StrippedElements lists the HTML elements stripped from the page by the sanitization policy of the WebServer
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=status,displayName="Stripped elements"
+	StrippedElements []string `json:"strippedElements,omitempty"`
+
+	// StrippedAttributes lists the HTML attributes stripped from the page by the sanitization policy
+	// of the WebServer, e.g. 'img[onerror]'
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=status,displayName="Stripped attributes"
+	StrippedAttributes []string `json:"strippedAttributes,omitempty"`
+}
+
+// PageRevision describes a stored revision of the page contents, the source of templates is stored
+// (templates are rendered when the revision is published)
+type PageRevision struct {
+	// Name of the revision (hash of the contents), it can be set to spec.revision to roll back
+	Name string `json:"name"`
+
+	// Created is the time the revision was stored
+	Created metav1.Time `json:"created"`
 }
 
 //+kubebuilder:object:root=true
@@ -0,0 +1,100 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// PageGrantType defines what a PageGrant allows
+// +kubebuilder:validation:Enum=Publish;Select
+type PageGrantType string
+
+const (
+	// PageGrantPublish allows pages in the From namespaces to be published into WebServers in the namespace
+	// of the grant (see Page spec.webserverNamespace)
+	PageGrantPublish PageGrantType = "Publish"
+	// PageGrantSelect allows WebServers in the From namespaces to select pages in the namespace of the grant
+	// (see WebServer spec.pageSelector.namespaceSelector)
+	PageGrantSelect PageGrantType = "Select"
+)
+
+// PageGrantSpec defines the desired state of PageGrant
+type PageGrantSpec struct {
+	// Type defines what the grant allows: Publish - pages in the From namespaces may be published into
+	// the WebServer in the namespace of the grant, Select - the WebServer in the From namespaces may select
+	// pages in the namespace of the grant
+	// +optional
+	// +kubebuilder:default=Publish
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Grant type"
+	Type PageGrantType `json:"type,omitempty"`
+
+	// WebServer defines the name of the WebServer resource (in the namespace of the grant for Publish,
+	// in the From namespaces for Select). If not set, the grant applies to all WebServers.
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="WebServer resource"
+	WebServer string `json:"webserver,omitempty"`
+
+	// From defines the namespaces, whose pages may be published into the WebServer (Publish),
+	// or whose WebServers may select the pages (Select)
+	// +kubebuilder:validation:MinItems=1
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Allowed namespaces"
+	From []PageGrantFrom `json:"from"`
+}
+
+// PageGrantFrom selects namespaces allowed to publish pages, exactly one of the fields shall be set
+type PageGrantFrom struct {
+	// Namespace defines the name of the allowed namespace
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// NamespaceSelector selects the allowed namespaces by labels
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+}
+
+// PageGrantStatus defines the observed state of PageGrant
+type PageGrantStatus struct {
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+
+// PageGrant is the Schema for the pagegrants API.
+// It allows Pages in other namespaces to reference WebServers in the namespace of the grant
+// (see Page spec.webserverNamespace), or WebServers in other namespaces to select Pages in the namespace
+// of the grant (type Select, see WebServer spec.pageSelector).
+type PageGrant struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PageGrantSpec   `json:"spec,omitempty"`
+	Status PageGrantStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// PageGrantList contains a list of PageGrant
+type PageGrantList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PageGrant `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&PageGrant{}, &PageGrantList{})
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RedirectSpec defines the desired state of Redirect
+// +kubebuilder:validation:XValidation:rule=`(has(self.regex) && self.regex) || !['\\', '$', '{', '}'].exists(c, self.from.contains(c))`,message="from must not contain \\, $, { or } unless regex is set"
+// +kubebuilder:validation:XValidation:rule=`!self.to.contains('\\')`,message="to must not contain \\"
+// +kubebuilder:validation:XValidation:rule=`(has(self.regex) && self.regex) ? !self.to.matches('[$]([^0-9]|$)') : !self.to.contains('$')`,message="to may contain $ only as a reference to a group of the regular expression ($1)"
+type RedirectSpec struct {
+	// WebServer defines the name of the WebServer resource (in the namespace of the redirect),
+	// whose nginx config the redirect is rendered into
+	// +kubebuilder:validation:Required
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="WebServer resource"
+	WebServer string `json:"webserver"`
+
+	// From defines the redirected path relative to the WebServer spec.pathPrefix, e.g. an old page name.
+	// It is a regular expression if Regex is set, otherwise it must not contain \, $, { and }.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern=`^[^\s;"']+$`
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="From path"
+	From string `json:"from"`
+
+	// To defines the target: a page name (relative to the WebServer spec.pathPrefix), an absolute path,
+	// or an URL. It may reference the groups of the From regular expression ($1), other $ (nginx variables)
+	// and backslashes are not allowed.
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern=`^[^\s;"']+$`
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Target path or URL"
+	To string `json:"to"`
+
+	// StatusCode defines the HTTP status code of the redirect
+	// +optional
+	// +kubebuilder:validation:Enum=301;302;307;308
+	// +kubebuilder:default=301
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Status code"
+	StatusCode int32 `json:"statusCode,omitempty"`
+
+	// Regex defines From as a regular expression, matched against the path after spec.pathPrefix
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Regular expression"
+	Regex bool `json:"regex,omitempty"`
+}
+
+// RedirectStatus defines the observed state of Redirect
+type RedirectStatus struct {
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+
+// Redirect is the Schema for the redirects API.
+// It redirects requests of a path of the WebServer to another page or URL.
+type Redirect struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   RedirectSpec   `json:"spec,omitempty"`
+	Status RedirectStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// RedirectList contains a list of Redirect
+type RedirectList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Redirect `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Redirect{}, &RedirectList{})
+}
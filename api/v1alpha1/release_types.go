@@ -0,0 +1,75 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ReleaseSpec defines the desired state of Release
+type ReleaseSpec struct {
+	// WebServer defines the name of the WebServer resource, whose rendered pages are frozen in the release
+	// +kubebuilder:validation:Required
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="WebServer resource"
+	WebServer string `json:"webserver,omitempty"`
+}
+
+// ReleaseStatus defines the observed state of Release
+type ReleaseStatus struct {
+	// Hash is the hash of the frozen pages
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	Hash string `json:"hash,omitempty"`
+
+	// ConfigMap is the name of the immutable ConfigMap holding the frozen pages
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	ConfigMap string `json:"configMap,omitempty"`
+
+	// Files is the number of the frozen files
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	Files int `json:"files,omitempty"`
+
+	// Conditions store the status conditions of the Release
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type" protobuf:"bytes,1,rep,name=conditions"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+
+// Release is the Schema for the releases API.
+// It freezes the set of rendered pages of a WebServer at the time of its creation,
+// the WebServer serves it when referenced in its spec.release.
+type Release struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ReleaseSpec   `json:"spec,omitempty"`
+	Status ReleaseStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ReleaseList contains a list of Release
+type ReleaseList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []Release `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&Release{}, &ReleaseList{})
+}
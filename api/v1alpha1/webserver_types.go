@@ -17,6 +17,7 @@ limitations under the License.
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -40,6 +41,385 @@ type WebServerSpec struct {
 	// +kubebuilder:default=1
 	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Number of pods"
 	Replicas int32 `json:"replicas,omitempty"`
+
+	// Variables defines user values available to page templates as .Variables
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Template variables"
+	Variables map[string]string `json:"variables,omitempty"`
+
+	// Preview enables the preview deployment, that serves draft pages together with the published ones
+	// on a separate host
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Preview"
+	Preview *PreviewSpec `json:"preview,omitempty"`
+
+	// Release defines the name of the Release to be served, the current pages are served if not set.
+	// Changing it switches the served pages atomically (the preview serves the current pages always).
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Pinned release"
+	Release string `json:"release,omitempty"`
+
+	// PageDeletionPolicy defines what happens to the pages of the WebServer when it is deleted:
+	// 'Delete' deletes them, 'Orphan' keeps them (they are published again, if the WebServer is recreated)
+	// +optional
+	// +kubebuilder:validation:Enum=Delete;Orphan
+	// +kubebuilder:default=Orphan
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Page deletion policy"
+	PageDeletionPolicy PageDeletionPolicy `json:"pageDeletionPolicy,omitempty"`
+
+	// PageSelector selects pages published by the WebServer by labels, in addition to the pages referencing
+	// the WebServer in their spec.webserver. A page may be selected by several WebServers.
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Page selector"
+	PageSelector *PageSelector `json:"pageSelector,omitempty"`
+
+	// Exposure defines how the WebServer is exposed outside the cluster, an Ingress is created if not set
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Exposure"
+	Exposure *ExposureSpec `json:"exposure,omitempty"`
+
+	// Service defines the Service of the WebServer, a ClusterIP Service on port 80 is created if not set
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Service"
+	Service *ServiceSpec `json:"service,omitempty"`
+
+	// PathPrefix defines the path the pages are served under, e.g. '/team-a/', so that several WebServers
+	// can share one host. Links to pages (template .Path) include it.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^/([^/]+/)*$`
+	// +kubebuilder:default=/
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Path prefix"
+	PathPrefix string `json:"pathPrefix,omitempty"`
+
+	// Access restricts access to the pages by basic auth and/or client addresses, the pages are public if not set
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Access"
+	Access *AccessSpec `json:"access,omitempty"`
+
+	// Auth defines the authentication of the users by an auth proxy sidecar in front of nginx
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Authentication"
+	Auth *AuthSpec `json:"auth,omitempty"`
+
+	// SecurityHeaders defines HTTP security headers added to all responses, '{}' sets the secure defaults
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Security headers"
+	SecurityHeaders *SecurityHeaders `json:"securityHeaders,omitempty"`
+
+	// Sanitize defines the sanitization policy of HTML pages, the pages are published verbatim if not set.
+	// SVG and XHTML files (they can contain scripts) are not published, if a policy other than 'none' is set.
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="HTML sanitization"
+	Sanitize *SanitizeSpec `json:"sanitize,omitempty"`
+
+	// AutoRedirect creates Redirects from the old names of renamed pages to the new ones
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Redirect renamed pages"
+	AutoRedirect bool `json:"autoRedirect,omitempty"`
+
+	// Proxies defines paths proxied to backend Services, e.g. an API of the site
+	// +optional
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Proxies"
+	Proxies []ProxySpec `json:"proxies,omitempty"`
+
+	// Mode defines how the pages are served: 'static' serves the files with directory listing,
+	// 'spa' (single-page application) falls back to index.html for unknown paths (history API routing),
+	// disables directory listing and index.html is not cached by clients
+	// +optional
+	// +kubebuilder:validation:Enum=static;spa
+	// +kubebuilder:default=static
+	// +operator-sdk:csv:customresourcedefinitions:type=spec,displayName="Serving mode"
+	Mode WebServerMode `json:"mode,omitempty"`
+}
+
+// ProxySpec defines a path proxied to a backend Service, the request URI is passed unchanged
+type ProxySpec struct {
+	// Path relative to spec.pathPrefix, matched as a prefix, e.g. 'api/'
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern=`^[^/\s;"'{}$][^\s;"'{}$]*$`
+	Path string `json:"path"`
+
+	// Service defines the name of the backend Service in the WebServer namespace
+	// +kubebuilder:validation:Required
+	Service string `json:"service"`
+
+	// Port defines the port number of the backend Service
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	Port int32 `json:"port"`
+
+	// ConnectTimeout defines the timeout of connecting to the backend, nginx default (60s) if not set
+	// +optional
+	ConnectTimeout *metav1.Duration `json:"connectTimeout,omitempty"`
+
+	// ReadTimeout defines the timeout between two reads of the backend response, nginx default (60s) if not set
+	// +optional
+	ReadTimeout *metav1.Duration `json:"readTimeout,omitempty"`
+
+	// SendTimeout defines the timeout between two writes of the request to the backend,
+	// nginx default (60s) if not set
+	// +optional
+	SendTimeout *metav1.Duration `json:"sendTimeout,omitempty"`
+}
+
+// SanitizePolicy defines which HTML elements and attributes are kept in the pages
+type SanitizePolicy string
+
+const (
+	// SanitizeNone publishes the pages verbatim
+	SanitizeNone SanitizePolicy = "none"
+	// SanitizeBasic strips scripts, frames, embedded objects, event handler attributes and 'javascript:' URLs
+	SanitizeBasic SanitizePolicy = "basic"
+	// SanitizeStrict keeps only the text formatting elements, links and images
+	SanitizeStrict SanitizePolicy = "strict"
+	// SanitizeCustom keeps only the elements and attributes listed in the SanitizeSpec
+	SanitizeCustom SanitizePolicy = "custom"
+)
+
+// SanitizeSpec defines the HTML sanitization policy
+type SanitizeSpec struct {
+	// Policy defines the sanitization policy
+	// +optional
+	// +kubebuilder:validation:Enum=none;basic;strict;custom
+	// +kubebuilder:default=basic
+	Policy SanitizePolicy `json:"policy,omitempty"`
+
+	// AllowedElements lists the elements kept by the 'custom' policy (html, head and body are kept always)
+	// +optional
+	AllowedElements []string `json:"allowedElements,omitempty"`
+
+	// AllowedAttributes lists the attributes kept by the 'custom' policy (on all allowed elements)
+	// +optional
+	AllowedAttributes []string `json:"allowedAttributes,omitempty"`
+}
+
+// SecurityHeaders defines HTTP security headers, a header is not sent if its value is set to empty
+// (or 0 for HSTS). 'X-Content-Type-Options: nosniff' is sent always.
+type SecurityHeaders struct {
+	// HSTSMaxAge defines max-age (in seconds) of the Strict-Transport-Security header
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:default=31536000
+	HSTSMaxAge *int64 `json:"hstsMaxAge,omitempty"`
+
+	// HSTSIncludeSubDomains adds 'includeSubDomains' to the Strict-Transport-Security header
+	// +optional
+	HSTSIncludeSubDomains bool `json:"hstsIncludeSubDomains,omitempty"`
+
+	// ContentSecurityPolicy defines the Content-Security-Policy header, it can be overridden by a Page.
+	// Hashes of inline scripts of the pages are added to its 'script-src' (or derived from 'default-src').
+	// +optional
+	// +kubebuilder:validation:Pattern=`^[^"\\$\r\n]*$`
+	// +kubebuilder:default="default-src 'self'"
+	ContentSecurityPolicy *string `json:"contentSecurityPolicy,omitempty"`
+
+	// FrameOptions defines the X-Frame-Options header
+	// +optional
+	// +kubebuilder:validation:Pattern=`^(DENY|SAMEORIGIN)?$`
+	// +kubebuilder:default=DENY
+	FrameOptions *string `json:"frameOptions,omitempty"`
+
+	// ReferrerPolicy defines the Referrer-Policy header
+	// +optional
+	// +kubebuilder:validation:Pattern=`^[-a-z,]*$`
+	// +kubebuilder:default=strict-origin-when-cross-origin
+	ReferrerPolicy *string `json:"referrerPolicy,omitempty"`
+
+	// PermissionsPolicy defines the Permissions-Policy header
+	// +optional
+	// +kubebuilder:validation:Pattern=`^[^"\\$\r\n]*$`
+	// +kubebuilder:default="camera=(), microphone=(), geolocation=()"
+	PermissionsPolicy *string `json:"permissionsPolicy,omitempty"`
+}
+
+// AuthSpec defines the authentication of the WebServer users
+type AuthSpec struct {
+	// OIDC authenticates the users by an OpenID Connect provider, using an oauth2-proxy sidecar
+	// +optional
+	OIDC *OIDCSpec `json:"oidc,omitempty"`
+}
+
+// OIDCSpec defines the OpenID Connect provider and the allowed users
+type OIDCSpec struct {
+	// IssuerURL is the URL of the OpenID Connect issuer
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern=`^https?://`
+	IssuerURL string `json:"issuerURL"`
+
+	// ClientSecretName is the name of a Secret in the WebServer namespace with keys 'client-id', 'client-secret'
+	// and 'cookie-secret' (16, 24 or 32 bytes)
+	// +kubebuilder:validation:Required
+	ClientSecretName string `json:"clientSecretName"`
+
+	// AllowedGroups restricts access to the members of the groups (the 'groups' claim), all authenticated
+	// users are allowed if empty
+	// +optional
+	AllowedGroups []string `json:"allowedGroups,omitempty"`
+
+	// Image defines the oauth2-proxy docker image
+	// +optional
+	// +kubebuilder:default="quay.io/oauth2-proxy/oauth2-proxy:v7.4.0"
+	Image string `json:"image,omitempty"`
+}
+
+// AccessSpec defines the access rules of the WebServer, the rule of the longest matching path applies,
+// the server-wide rule applies to the paths not listed
+type AccessSpec struct {
+	AccessRule `json:",inline"`
+
+	// Paths defines access rules of page paths, they replace the server-wide rule
+	// (a path with an empty rule is public)
+	// +optional
+	Paths []PathAccess `json:"paths,omitempty"`
+}
+
+// PathAccess defines the access rule of a page path
+type PathAccess struct {
+	// Path relative to spec.pathPrefix, matched as a prefix of the page names, e.g. 'internal-'
+	// for pages 'internal-*', or a page name
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:Pattern=`^[-._a-zA-Z0-9]+$`
+	Path string `json:"path"`
+
+	AccessRule `json:",inline"`
+}
+
+// AccessRule restricts access by basic auth and client addresses, both have to be satisfied if set
+type AccessRule struct {
+	// BasicAuth requires the users to authenticate
+	// +optional
+	BasicAuth *BasicAuth `json:"basicAuth,omitempty"`
+
+	// Allow lists CIDRs of allowed clients, all clients are allowed if empty
+	// +optional
+	Allow []string `json:"allow,omitempty"`
+
+	// Deny lists CIDRs of denied clients, they take precedence over Allow
+	// +optional
+	Deny []string `json:"deny,omitempty"`
+}
+
+// BasicAuth defines the users of basic auth
+type BasicAuth struct {
+	// SecretName is the name of a Secret in the WebServer namespace with the users: either of type
+	// 'kubernetes.io/basic-auth', or with user names as keys and passwords as values
+	// +kubebuilder:validation:Required
+	SecretName string `json:"secretName"`
+
+	// Realm shown by browsers, quotes, backslashes, '$' and line breaks are not allowed
+	// +optional
+	// +kubebuilder:default=Restricted
+	// +kubebuilder:validation:Pattern=`^[^"\\$\r\n]*$`
+	Realm string `json:"realm,omitempty"`
+}
+
+// ServiceSpec defines the Service of the WebServer (and of its preview)
+type ServiceSpec struct {
+	// Type of the Service
+	// +optional
+	// +kubebuilder:validation:Enum=ClusterIP;NodePort;LoadBalancer
+	// +kubebuilder:default=ClusterIP
+	Type corev1.ServiceType `json:"type,omitempty"`
+
+	// Port of the Service
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	// +kubebuilder:default=80
+	Port int32 `json:"port,omitempty"`
+
+	// Annotations added to the Service, e.g. for the cloud load balancer
+	// +optional
+	Annotations map[string]string `json:"annotations,omitempty"`
+
+	// SessionAffinity of the Service
+	// +optional
+	// +kubebuilder:validation:Enum=None;ClientIP
+	// +kubebuilder:default=None
+	SessionAffinity corev1.ServiceAffinity `json:"sessionAffinity,omitempty"`
+}
+
+// ExposureType defines the kind of object exposing the WebServer
+type ExposureType string
+
+const (
+	ExposureIngress ExposureType = "ingress"
+	ExposureGateway ExposureType = "gateway"
+	ExposureNone    ExposureType = "none"
+)
+
+// ExposureSpec defines how the WebServer is exposed
+type ExposureSpec struct {
+	// Type defines the kind of exposure: 'ingress' creates an Ingress, 'gateway' creates a Gateway API HTTPRoute,
+	// 'none' exposes the WebServer by its Service only
+	// +optional
+	// +kubebuilder:validation:Enum=ingress;gateway;none
+	// +kubebuilder:default=ingress
+	Type ExposureType `json:"type,omitempty"`
+
+	// Gateway defines the HTTPRoute of the 'gateway' exposure
+	// +optional
+	Gateway *GatewaySpec `json:"gateway,omitempty"`
+}
+
+// GatewaySpec defines the HTTPRoute attached to a Gateway
+type GatewaySpec struct {
+	// Name of the Gateway the HTTPRoute is attached to
+	// +kubebuilder:validation:Required
+	Name string `json:"name"`
+
+	// Namespace of the Gateway, defaults to the namespace of the WebServer
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+
+	// SectionName defines the listener of the Gateway
+	// +optional
+	SectionName string `json:"sectionName,omitempty"`
+
+	// Hostnames of the HTTPRoute, defaults to the ingress domain (INGRESS_DOMAIN)
+	// (the preview HTTPRoute uses the preview host always)
+	// +optional
+	Hostnames []string `json:"hostnames,omitempty"`
+
+	// PathPrefix defines the path prefix matched by the HTTPRoute, defaults to spec.pathPrefix of the WebServer
+	// +optional
+	// +kubebuilder:validation:Pattern=`^/`
+	PathPrefix string `json:"pathPrefix,omitempty"`
+}
+
+// PageSelector selects pages by labels
+type PageSelector struct {
+	metav1.LabelSelector `json:",inline"`
+
+	// NamespaceSelector selects namespaces of the pages, only pages in the namespace of the WebServer
+	// are selected if not set. Pages in other namespaces are selected only if a PageGrant of type Select
+	// in their namespace allows the namespace of the WebServer.
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+}
+
+// PageDeletionPolicy defines what happens to the pages of a deleted WebServer
+type PageDeletionPolicy string
+
+const (
+	PageDeletionPolicyDelete PageDeletionPolicy = "Delete"
+	PageDeletionPolicyOrphan PageDeletionPolicy = "Orphan"
+)
+
+// WebServerMode defines how the pages are served
+type WebServerMode string
+
+const (
+	WebServerModeStatic WebServerMode = "static"
+	WebServerModeSPA    WebServerMode = "spa"
+)
+
+// PreviewSpec defines the preview deployment of the WebServer
+type PreviewSpec struct {
+	// Host defines the host name of the preview ingress, defaults to '<webserver name>-preview.<ingress domain>'
+	// +optional
+	Host string `json:"host,omitempty"`
 }
 
 // WebServerStatus defines the observed state of WebServer
@@ -47,6 +427,24 @@ type WebServerStatus struct {
 	// Conditions store the status conditions of the Memcached instances
 	// +operator-sdk:csv:customresourcedefinitions:type=status
 	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type" protobuf:"bytes,1,rep,name=conditions"`
+
+	// PagesHash is the hash of the published pages
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	PagesHash string `json:"pagesHash,omitempty"`
+
+	// Pages lists the pages ('namespace/name') published by the WebServer, either referencing it or selected
+	// by spec.pageSelector
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	Pages []string `json:"pages,omitempty"`
+
+	// Address is the external address (IP or host name) of the WebServer, as assigned to the LoadBalancer Service
+	// or to the Ingress
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	Address string `json:"address,omitempty"`
+
+	// ErrorCodes lists the HTTP status codes served by error pages (see Page spec.errorCode)
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	ErrorCodes []int32 `json:"errorCodes,omitempty"`
 }
 
 //+kubebuilder:object:root=true
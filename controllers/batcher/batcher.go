@@ -0,0 +1,119 @@
+// Package batcher coalesces changes of pages per WebServer, so that a bulk change of many pages
+// results in a single update of the web server. The changes are recorded by the watch map functions
+// and the web server is enqueued through Source only when the batch is due, so other reconciles
+// of the web server are not delayed.
+package batcher
+
+import (
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// batch holds the pending changes of a web server
+type batch struct {
+	first time.Time   // time of the first change
+	last  time.Time   // time of the last change
+	size  int         // number of changes
+	timer *time.Timer // fires when the batch is due
+}
+
+// Batcher collects changes per web server, the changes are due when no change came for QuietPeriod,
+// or when the first change waits for MaxDelay
+type Batcher struct {
+	quietPeriod time.Duration
+	maxDelay    time.Duration
+
+	mu      sync.Mutex
+	pending map[types.NamespacedName]*batch
+	events  chan event.GenericEvent
+}
+
+// New creates a Batcher
+func New(quietPeriod, maxDelay time.Duration) *Batcher {
+	if maxDelay < quietPeriod {
+		maxDelay = quietPeriod
+	}
+	return &Batcher{
+		quietPeriod: quietPeriod,
+		maxDelay:    maxDelay,
+		pending:     make(map[types.NamespacedName]*batch),
+		events:      make(chan event.GenericEvent),
+	}
+}
+
+// Source returns the source of events of web servers with due changes (to be watched by the controller)
+func (b *Batcher) Source() source.Source {
+	return &source.Channel{Source: b.events}
+}
+
+// Touch records a change of the web server, the web server is sent to Source when the changes are due
+func (b *Batcher) Touch(web types.NamespacedName) {
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	bt, ok := b.pending[web]
+	if !ok {
+		bt = &batch{first: now}
+		b.pending[web] = bt
+	}
+	bt.last = now
+	bt.size++
+	if bt.timer == nil {
+		bt.timer = time.AfterFunc(b.wait(bt), func() { b.fire(web) })
+	} else {
+		bt.timer.Reset(b.wait(bt))
+	}
+	changesTotal.Inc()
+	pendingGauge.Set(float64(len(b.pending)))
+}
+
+// wait returns how long to wait before the changes of the batch are due
+func (b *Batcher) wait(bt *batch) time.Duration {
+	at := bt.last.Add(b.quietPeriod)
+	if deadline := bt.first.Add(b.maxDelay); deadline.Before(at) {
+		at = deadline
+	}
+	return time.Until(at)
+}
+
+// fire sends the web server with due changes to Source (blocks until the controller takes it)
+func (b *Batcher) fire(web types.NamespacedName) {
+	b.events <- event.GenericEvent{Object: &metav1.PartialObjectMetadata{
+		ObjectMeta: metav1.ObjectMeta{Namespace: web.Namespace, Name: web.Name},
+	}}
+}
+
+// Done marks the changes of the web server as processed
+func (b *Batcher) Done(web types.NamespacedName) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	bt, ok := b.pending[web]
+	if !ok {
+		return
+	}
+	bt.timer.Stop()
+	delete(b.pending, web)
+	batchesTotal.Inc()
+	batchSize.Observe(float64(bt.size))
+	batchDelay.Observe(time.Since(bt.first).Seconds())
+	pendingGauge.Set(float64(len(b.pending)))
+}
+
+// Forget drops the changes of a deleted web server
+func (b *Batcher) Forget(web types.NamespacedName) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if bt, ok := b.pending[web]; ok {
+		bt.timer.Stop()
+	}
+	delete(b.pending, web)
+	pendingGauge.Set(float64(len(b.pending)))
+}
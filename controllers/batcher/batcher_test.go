@@ -0,0 +1,140 @@
+package batcher
+
+import (
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+)
+
+var _ = Describe("Batcher", func() {
+	web := types.NamespacedName{Namespace: "ns", Name: "web"}
+	const quiet = 50 * time.Millisecond
+	var b *Batcher
+
+	// due returns the time the next event of the batcher arrives at
+	due := func() time.Time {
+		var e event.GenericEvent
+		Eventually(b.events).Should(Receive(&e))
+		Expect(e.Object.GetNamespace()).To(Equal(web.Namespace))
+		Expect(e.Object.GetName()).To(Equal(web.Name))
+		return time.Now()
+	}
+
+	BeforeEach(func() {
+		b = New(quiet, 4*quiet)
+	})
+
+	It("sends the web server after the quiet period", func() {
+		start := time.Now()
+		b.Touch(web)
+		Expect(due().Sub(start)).To(BeNumerically(">=", quiet))
+	})
+
+	It("coalesces changes into one event", func() {
+		start := time.Now()
+		for i := 0; i < 5; i++ {
+			b.Touch(web)
+			time.Sleep(quiet / 5)
+		}
+		Expect(due().Sub(start)).To(BeNumerically(">=", quiet+4*quiet/5))
+		Consistently(b.events, 2*quiet).ShouldNot(Receive())
+	})
+
+	It("does not delay continuous changes over the max delay", func() {
+		start := time.Now()
+		stop := make(chan struct{})
+		go func(b *Batcher) {
+			defer GinkgoRecover()
+			for {
+				select {
+				case <-stop:
+					return
+				case <-time.After(quiet / 5):
+					b.Touch(web)
+				}
+			}
+		}(b)
+		defer close(stop)
+		b.Touch(web)
+		Expect(due().Sub(start)).To(BeNumerically("~", 4*quiet, 3*quiet))
+	})
+
+	It("sends nothing when the changes are processed or forgotten", func() {
+		b.Touch(web)
+		b.Done(web)
+		other := types.NamespacedName{Namespace: "ns", Name: "other"}
+		b.Touch(other)
+		b.Forget(other)
+		Consistently(b.events, 2*quiet).ShouldNot(Receive())
+		Expect(b.pending).To(BeEmpty())
+	})
+
+	It("caps the max delay to the quiet period", func() {
+		Expect(New(time.Second, time.Millisecond).maxDelay).To(Equal(time.Second))
+	})
+})
+
+var _ = Describe("Batcher metrics", func() {
+	web := types.NamespacedName{Namespace: "ns", Name: "web"}
+	other := types.NamespacedName{Namespace: "ns", Name: "other"}
+
+	// histogram returns the current state of the histogram
+	histogram := func(h prometheus.Histogram) *dto.Histogram {
+		m := &dto.Metric{}
+		Expect(h.Write(m)).To(Succeed())
+		return m.GetHistogram()
+	}
+	// expectPending checks the pending gauge
+	expectPending := func(n string) {
+		expected := `
+# HELP webid_page_batch_pending Number of web servers with pending page changes
+# TYPE webid_page_batch_pending gauge
+webid_page_batch_pending ` + n + "\n"
+		Expect(testutil.CollectAndCompare(pendingGauge, strings.NewReader(expected))).To(Succeed())
+	}
+
+	It("counts changes, batches and pending web servers", func() {
+		b := New(time.Hour, time.Hour)
+		changes, batches := testutil.ToFloat64(changesTotal), testutil.ToFloat64(batchesTotal)
+
+		b.Touch(web)
+		b.Touch(web)
+		b.Touch(other)
+		Expect(testutil.ToFloat64(changesTotal) - changes).To(Equal(3.0))
+		expectPending("2")
+
+		b.Done(web)
+		Expect(testutil.ToFloat64(batchesTotal) - batches).To(Equal(1.0))
+		expectPending("1")
+
+		b.Forget(other)
+		Expect(testutil.ToFloat64(batchesTotal) - batches).To(Equal(1.0))
+		expectPending("0")
+	})
+
+	It("observes sizes and delays of processed batches", func() {
+		b := New(time.Hour, time.Hour)
+		sizes, delays := histogram(batchSize), histogram(batchDelay)
+		b.Touch(web)
+		b.Touch(web)
+		b.Touch(web)
+		b.Done(web)
+		Expect(histogram(batchSize).GetSampleCount() - sizes.GetSampleCount()).To(Equal(uint64(1)))
+		Expect(histogram(batchSize).GetSampleSum() - sizes.GetSampleSum()).To(Equal(3.0))
+		Expect(histogram(batchDelay).GetSampleCount() - delays.GetSampleCount()).To(Equal(uint64(1)))
+	})
+
+	It("has valid metric names and help", func() {
+		for _, c := range []prometheus.Collector{changesTotal, batchesTotal, pendingGauge, batchSize, batchDelay} {
+			Expect(testutil.CollectAndLint(c)).To(BeEmpty())
+		}
+	})
+})
@@ -0,0 +1,35 @@
+package batcher
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
+
+var (
+	changesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "webid_page_changes_total",
+		Help: "Number of page changes recorded by the batcher",
+	})
+	batchesTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "webid_page_batches_total",
+		Help: "Number of processed batches of page changes",
+	})
+	pendingGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "webid_page_batch_pending",
+		Help: "Number of web servers with pending page changes",
+	})
+	batchSize = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "webid_page_batch_size",
+		Help:    "Number of page changes coalesced in a processed batch",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 10),
+	})
+	batchDelay = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "webid_page_batch_delay_seconds",
+		Help:    "Delay between the first page change of a batch and its processing",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 10),
+	})
+)
+
+func init() {
+	metrics.Registry.MustRegister(changesTotal, batchesTotal, pendingGauge, batchSize, batchDelay)
+}
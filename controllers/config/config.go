@@ -1,11 +1,29 @@
 package config
 
-import "github.com/ilyakaznacheev/cleanenv"
+import (
+	"time"
+
+	"github.com/ilyakaznacheev/cleanenv"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+)
 
 // Config of the controllers
 type Config struct {
 	IngressDomain string `env:"INGRESS_DOMAIN"              env-required:"true"`
 	IngressClass  string `env:"INGRESS_CLASS"              env-default:"nginx"`
+	// DataRetention is the number of old data configMaps kept for each web server (after a content change),
+	// the ones still mounted by running pods are kept in addition
+	DataRetention int `env:"DATA_RETENTION"              env-default:"3"`
+	// PageQuietPeriod is the time without page changes, after which the changes are published to the web server
+	PageQuietPeriod time.Duration `env:"PAGE_QUIET_PERIOD"              env-default:"2s"`
+	// PageMaxDelay is the longest time a page change waits to be published (in case of continuous changes)
+	PageMaxDelay time.Duration `env:"PAGE_MAX_DELAY"              env-default:"10s"`
+	// Resolver is the DNS server nginx resolves the proxy backend Services with, they are resolved per request,
+	// so that nginx starts (and keeps serving the pages) even if a backend Service is missing
+	Resolver string `env:"RESOLVER"              env-default:"kube-dns.kube-system.svc.cluster.local"`
+	// ClusterDomain is the DNS domain of the cluster, nginx resolver needs the full names of the Services
+	ClusterDomain string `env:"CLUSTER_DOMAIN"              env-default:"cluster.local"`
 }
 
 // New creates and initializes configuration
@@ -18,3 +36,11 @@ func New() (*Config, error) {
 	}
 	return cfg, nil
 }
+
+// PreviewHost returns the host name of the preview deployment of the web server
+func (c *Config) PreviewHost(web *webidv1alpha1.WebServer) string {
+	if web.Spec.Preview != nil && web.Spec.Preview.Host != "" {
+		return web.Spec.Preview.Host
+	}
+	return web.Name + "-preview." + c.IngressDomain
+}
@@ -0,0 +1,115 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+)
+
+var _ = Describe("WebServer deletion", func() {
+	const timeout, interval = 10 * time.Second, 100 * time.Millisecond
+	ctx := context.Background()
+	var namespace string
+
+	newPage := func(name string) *webidv1alpha1.Page {
+		page := &webidv1alpha1.Page{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Spec:       webidv1alpha1.PageSpec{WebServer: "web", Name: name + ".html", Contents: "<p>" + name + "</p>"},
+		}
+		Expect(k8sClient.Create(ctx, page)).To(Succeed())
+		return page
+	}
+	// deleteWebServer deletes the web server once it is reconciled (has the finalizer) and waits until it is gone
+	deleteWebServer := func(web *webidv1alpha1.WebServer) {
+		Eventually(func(g Gomega) {
+			g.Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(web), web)).To(Succeed())
+			g.Expect(web.Finalizers).NotTo(BeEmpty())
+		}, timeout, interval).Should(Succeed())
+		Expect(k8sClient.Delete(ctx, web)).To(Succeed())
+		Eventually(func() bool {
+			return apierrors.IsNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(web), web))
+		}, timeout, interval).Should(BeTrue())
+	}
+	// webServerMissing returns the WebServerMissing condition of the page
+	webServerMissing := func(page *webidv1alpha1.Page) func() metav1.ConditionStatus {
+		return func() metav1.ConditionStatus {
+			p := &webidv1alpha1.Page{}
+			if err := k8sClient.Get(ctx, client.ObjectKeyFromObject(page), p); err != nil {
+				return ""
+			}
+			if c := meta.FindStatusCondition(p.Status.Conditions, "WebServerMissing"); c != nil {
+				return c.Status
+			}
+			return ""
+		}
+	}
+
+	BeforeEach(func() {
+		namespace = newNamespace(ctx)
+	})
+
+	It("deletes the pages with the Delete policy", func() {
+		web := newWebServer(namespace, "web")
+		web.Spec.PageDeletionPolicy = webidv1alpha1.PageDeletionPolicyDelete
+		Expect(k8sClient.Create(ctx, web)).To(Succeed())
+		pageList := []*webidv1alpha1.Page{newPage("a"), newPage("b")}
+		other := &webidv1alpha1.Page{
+			ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "other"},
+			Spec:       webidv1alpha1.PageSpec{WebServer: "other", Name: "other.html", Contents: "<p>other</p>"},
+		}
+		Expect(k8sClient.Create(ctx, other)).To(Succeed())
+		Eventually(webServerMissing(pageList[0]), timeout, interval).Should(Equal(metav1.ConditionFalse))
+
+		deleteWebServer(web)
+		for _, page := range pageList {
+			Eventually(func() bool {
+				return apierrors.IsNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(page), &webidv1alpha1.Page{}))
+			}, timeout, interval).Should(BeTrue())
+		}
+		Consistently(func() error {
+			return k8sClient.Get(ctx, client.ObjectKeyFromObject(other), &webidv1alpha1.Page{})
+		}, time.Second, interval).Should(Succeed())
+	})
+
+	It("orphans the pages with the Orphan policy, they are published again when the WebServer is recreated", func() {
+		web := newWebServer(namespace, "web")
+		web.Spec.PageDeletionPolicy = webidv1alpha1.PageDeletionPolicyOrphan
+		Expect(k8sClient.Create(ctx, web)).To(Succeed())
+		page := newPage("a")
+		Eventually(webServerMissing(page), timeout, interval).Should(Equal(metav1.ConditionFalse))
+
+		deleteWebServer(web)
+		Eventually(webServerMissing(page), timeout, interval).Should(Equal(metav1.ConditionTrue))
+		Consistently(func() error {
+			return k8sClient.Get(ctx, client.ObjectKeyFromObject(page), &webidv1alpha1.Page{})
+		}, time.Second, interval).Should(Succeed())
+
+		Expect(k8sClient.Create(ctx, newWebServer(namespace, "web"))).To(Succeed())
+		Eventually(webServerMissing(page), timeout, interval).Should(Equal(metav1.ConditionFalse))
+		Eventually(func(g Gomega) {
+			recreated := &webidv1alpha1.WebServer{}
+			g.Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: namespace, Name: "web"}, recreated)).To(Succeed())
+			g.Expect(recreated.Status.Pages).To(ConsistOf(namespace + "/a"))
+		}, timeout, interval).Should(Succeed())
+	})
+
+	It("keeps a page of a missing WebServer waiting without errors", func() {
+		page := newPage("a")
+		Eventually(webServerMissing(page), timeout, interval).Should(Equal(metav1.ConditionTrue))
+
+		Expect(k8sClient.Delete(ctx, page)).To(Succeed())
+		Eventually(func() bool {
+			return apierrors.IsNotFound(k8sClient.Get(ctx, client.ObjectKeyFromObject(page), &webidv1alpha1.Page{}))
+		}, timeout, interval).Should(BeTrue())
+	})
+})
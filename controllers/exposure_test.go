@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	netv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+)
+
+var _ = Describe("WebServer exposure", func() {
+	const timeout, interval = 10 * time.Second, 100 * time.Millisecond
+	ctx := context.Background()
+	var key types.NamespacedName
+
+	newRoute := func() *unstructured.Unstructured {
+		route := &unstructured.Unstructured{}
+		route.SetGroupVersionKind(schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1beta1", Kind: "HTTPRoute"})
+		return route
+	}
+	ingressExists := func() bool {
+		err := k8sClient.Get(ctx, key, &netv1.Ingress{})
+		Expect(err == nil || apierrors.IsNotFound(err)).To(BeTrue())
+		return err == nil
+	}
+	routeExists := func() bool {
+		err := k8sClient.Get(ctx, key, newRoute())
+		Expect(err == nil || apierrors.IsNotFound(err)).To(BeTrue())
+		return err == nil
+	}
+	condition := func(typ string) func() metav1.ConditionStatus {
+		return func() metav1.ConditionStatus {
+			web := &webidv1alpha1.WebServer{}
+			Expect(k8sClient.Get(ctx, key, web)).To(Succeed())
+			if c := meta.FindStatusCondition(web.Status.Conditions, typ); c != nil {
+				return c.Status
+			}
+			return ""
+		}
+	}
+
+	BeforeEach(func() {
+		web := newWebServer(newNamespace(ctx), "web")
+		key = types.NamespacedName{Namespace: web.Namespace, Name: web.Name}
+		Expect(k8sClient.Create(ctx, web)).To(Succeed())
+	})
+
+	It("switches between the Ingress and the HTTPRoute, deleting the stale one", func() {
+		Eventually(ingressExists, timeout, interval).Should(BeTrue())
+		Expect(routeExists()).To(BeFalse())
+
+		By("switching to the gateway exposure")
+		updateWebServer(ctx, key, func(web *webidv1alpha1.WebServer) {
+			web.Spec.Exposure = &webidv1alpha1.ExposureSpec{Type: webidv1alpha1.ExposureGateway,
+				Gateway: &webidv1alpha1.GatewaySpec{Name: "gw", Namespace: "infra", Hostnames: []string{"docs.example.com"}}}
+		})
+		Eventually(routeExists, timeout, interval).Should(BeTrue())
+		Eventually(ingressExists, timeout, interval).Should(BeFalse())
+
+		route := newRoute()
+		Expect(k8sClient.Get(ctx, key, route)).To(Succeed())
+		parents, _, _ := unstructured.NestedSlice(route.Object, "spec", "parentRefs")
+		Expect(parents).To(ConsistOf(map[string]interface{}{"name": "gw", "namespace": "infra"}))
+		hostnames, _, _ := unstructured.NestedStringSlice(route.Object, "spec", "hostnames")
+		Expect(hostnames).To(Equal([]string{"docs.example.com"}))
+		Eventually(condition("RouteAccepted"), timeout, interval).Should(Equal(metav1.ConditionUnknown))
+
+		By("reflecting the route status set by the Gateway")
+		Expect(unstructured.SetNestedSlice(route.Object, []interface{}{
+			map[string]interface{}{
+				"parentRef":      map[string]interface{}{"name": "gw", "namespace": "infra"},
+				"controllerName": "example.com/gateway-controller",
+				"conditions": []interface{}{
+					map[string]interface{}{"type": "Accepted", "status": "True", "reason": "Accepted", "message": "ok",
+						"lastTransitionTime": "2023-01-01T00:00:00Z"},
+					map[string]interface{}{"type": "ResolvedRefs", "status": "False", "reason": "BackendNotFound", "message": "no",
+						"lastTransitionTime": "2023-01-01T00:00:00Z"},
+				},
+			},
+		}, "status", "parents")).To(Succeed())
+		Expect(k8sClient.Status().Update(ctx, route)).To(Succeed())
+		Eventually(condition("RouteAccepted"), timeout, interval).Should(Equal(metav1.ConditionTrue))
+		Eventually(condition("RouteResolvedRefs"), timeout, interval).Should(Equal(metav1.ConditionFalse))
+
+		By("switching to no exposure")
+		updateWebServer(ctx, key, func(web *webidv1alpha1.WebServer) {
+			web.Spec.Exposure = &webidv1alpha1.ExposureSpec{Type: webidv1alpha1.ExposureNone}
+		})
+		Eventually(routeExists, timeout, interval).Should(BeFalse())
+		Expect(ingressExists()).To(BeFalse())
+		Eventually(condition("RouteAccepted"), timeout, interval).Should(BeEmpty())
+
+		By("switching back to the ingress exposure")
+		updateWebServer(ctx, key, func(web *webidv1alpha1.WebServer) {
+			web.Spec.Exposure = nil
+		})
+		Eventually(ingressExists, timeout, interval).Should(BeTrue())
+		Consistently(routeExists, time.Second, interval).Should(BeFalse())
+	})
+})
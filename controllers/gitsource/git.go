@@ -0,0 +1,192 @@
+package gitsource
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// maxFileSize is the biggest file published from a repository (ConfigMap size is limited to 1MiB)
+const maxFileSize = 1 << 20
+
+// errKnownHostsMissing is returned for SSH repositories without known_hosts, host keys are always verified
+var errKnownHostsMissing = errors.New("the 'known_hosts' key of the credentials Secret is required for SSH repositories")
+
+// repository describes a git repository to fetch
+type repository struct {
+	url       string
+	ref       string
+	directory string
+
+	// HTTPS credentials
+	username string
+	password string
+
+	// SSH credentials
+	sshKey     []byte
+	knownHosts []byte
+}
+
+// snapshot is the result of fetching the repository
+type snapshot struct {
+	commit string
+	// files maps paths (relative to the directory, '/' separated) to file contents
+	files map[string][]byte
+}
+
+// isSSH returns true for ssh:// and scp-like (user@host:path) repository URLs
+func isSSH(url string) bool {
+	if strings.HasPrefix(url, "ssh://") || strings.HasPrefix(url, "git+ssh://") {
+		return true
+	}
+	if strings.Contains(url, "://") {
+		return false
+	}
+	host, _, found := strings.Cut(url, ":")
+	return found && !strings.Contains(host, "/")
+}
+
+// validate checks, that the host key of an SSH repository can be verified
+func (repo repository) validate() error {
+	if isSSH(repo.url) && len(repo.knownHosts) == 0 {
+		return errKnownHostsMissing
+	}
+	return nil
+}
+
+// fetch makes a shallow clone of the repository and reads files from the configured directory
+func fetch(ctx context.Context, repo repository) (*snapshot, error) {
+	if err := repo.validate(); err != nil {
+		return nil, err
+	}
+	tmp, err := os.MkdirTemp("", "gitsource-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	env, err := repo.gitEnv(tmp)
+	if err != nil {
+		return nil, err
+	}
+
+	checkout := filepath.Join(tmp, "checkout")
+	args := []string{"clone", "--depth", "1", "--no-tags", "--single-branch"}
+	if repo.ref != "" {
+		args = append(args, "--branch", repo.ref)
+	}
+	args = append(args, "--", repo.url, checkout)
+	if _, err = git(ctx, env, args...); err != nil {
+		return nil, err
+	}
+
+	commit, err := git(ctx, env, "-C", checkout, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := readFiles(filepath.Join(checkout, filepath.Clean("/"+repo.directory)))
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot{commit: commit, files: files}, nil
+}
+
+// gitEnv returns environment for git commands, credentials are passed in the environment or in files in dir
+func (repo repository) gitEnv(dir string) ([]string, error) {
+	env := []string{
+		"HOME=" + dir,
+		"PATH=" + os.Getenv("PATH"),
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_CONFIG_NOSYSTEM=1",
+	}
+
+	if repo.username != "" || repo.password != "" {
+		auth := base64.StdEncoding.EncodeToString([]byte(repo.username + ":" + repo.password))
+		env = append(env,
+			"GIT_CONFIG_COUNT=1",
+			"GIT_CONFIG_KEY_0=http.extraHeader",
+			"GIT_CONFIG_VALUE_0=Authorization: Basic "+auth,
+		)
+	}
+
+	if isSSH(repo.url) {
+		if len(repo.knownHosts) == 0 {
+			return nil, errKnownHostsMissing
+		}
+		hostsFile := filepath.Join(dir, "known_hosts")
+		if err := os.WriteFile(hostsFile, repo.knownHosts, 0o600); err != nil {
+			return nil, err
+		}
+		sshCmd := "ssh -o BatchMode=yes -o StrictHostKeyChecking=yes -o UserKnownHostsFile=" + hostsFile
+		if len(repo.sshKey) > 0 {
+			keyFile := filepath.Join(dir, "id")
+			if err := os.WriteFile(keyFile, repo.sshKey, 0o600); err != nil {
+				return nil, err
+			}
+			sshCmd += " -i " + keyFile + " -o IdentitiesOnly=yes"
+		}
+		env = append(env, "GIT_SSH_COMMAND="+sshCmd)
+	}
+	return env, nil
+}
+
+// git runs a git command and returns its trimmed output
+func git(ctx context.Context, env []string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Env = env
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// readFiles reads regular files in dir recursively, '.git' directories and too big files are skipped
+func readFiles(dir string) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil // symlinks etc.
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.Size() > maxFileSize {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = data
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
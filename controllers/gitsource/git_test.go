@@ -0,0 +1,120 @@
+package gitsource
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("fetch", func() {
+	var (
+		bare   string
+		commit string
+	)
+
+	// run runs a git command in dir and returns its output
+	run := func(dir string, args ...string) string {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(),
+			"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com")
+		out, err := cmd.CombinedOutput()
+		Expect(err).NotTo(HaveOccurred(), string(out))
+		return string(out)
+	}
+
+	BeforeEach(func() {
+		if _, err := exec.LookPath("git"); err != nil {
+			Skip("git binary not available")
+		}
+
+		tmp := GinkgoT().TempDir()
+		bare = filepath.Join(tmp, "repo.git")
+		work := filepath.Join(tmp, "work")
+		run(tmp, "init", "--bare", "--initial-branch=main", bare)
+		run(tmp, "clone", bare, work)
+
+		Expect(os.MkdirAll(filepath.Join(work, "docs", "img"), 0o755)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(work, "README.md"), []byte("readme"), 0o644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(work, "docs", "index.html"), []byte("<h1>v1</h1>"), 0o644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(work, "docs", "img", "logo.png"), []byte{0x89, 'P', 'N', 'G', 0xff}, 0o644)).To(Succeed())
+		run(work, "add", ".")
+		run(work, "commit", "-m", "v1")
+		run(work, "tag", "v1")
+		commit = run(work, "rev-parse", "HEAD")
+
+		Expect(os.WriteFile(filepath.Join(work, "docs", "index.html"), []byte("<h1>v2</h1>"), 0o644)).To(Succeed())
+		run(work, "commit", "-am", "v2")
+		run(work, "push", "origin", "main", "v1")
+	})
+
+	It("publishes the whole repository by default", func() {
+		snap, err := fetch(context.Background(), repository{url: bare})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(snap.files).To(HaveKey("README.md"))
+		Expect(snap.files).To(HaveKeyWithValue("docs/index.html", []byte("<h1>v2</h1>")))
+		Expect(snap.files).NotTo(HaveKey(ContainSubstring(".git")))
+	})
+
+	It("publishes the subdirectory of the tag", func() {
+		snap, err := fetch(context.Background(), repository{url: bare, ref: "v1", directory: "docs"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(snap.commit).To(Equal(strings.TrimSpace(commit)))
+		Expect(snap.files).To(HaveLen(2))
+		Expect(snap.files).To(HaveKeyWithValue("index.html", []byte("<h1>v1</h1>")))
+		Expect(snap.files).To(HaveKey("img/logo.png"))
+	})
+
+	It("fails for unknown ref", func() {
+		_, err := fetch(context.Background(), repository{url: bare, ref: "nope"})
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("ssh", func() {
+	DescribeTable("isSSH",
+		func(url string, expected bool) {
+			Expect(isSSH(url)).To(Equal(expected))
+		},
+		Entry("ssh URL", "ssh://git@example.com/site.git", true),
+		Entry("scp-like", "git@example.com:org/site.git", true),
+		Entry("https", "https://example.com/org/site.git", false),
+		Entry("local path", "/srv/git/site.git", false),
+		Entry("relative path with colon", "repos/a:b", false),
+	)
+
+	It("requires known_hosts for SSH repositories", func() {
+		repo := repository{url: "git@example.com:org/site.git", sshKey: []byte("key")}
+		Expect(repo.validate()).To(MatchError(errKnownHostsMissing))
+		_, err := repo.gitEnv(GinkgoT().TempDir())
+		Expect(err).To(MatchError(errKnownHostsMissing))
+	})
+
+	It("verifies the host key", func() {
+		dir := GinkgoT().TempDir()
+		repo := repository{url: "ssh://git@example.com/site.git", sshKey: []byte("key"), knownHosts: []byte("example.com ssh-ed25519 AAAA")}
+		Expect(repo.validate()).To(Succeed())
+		env, err := repo.gitEnv(dir)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(env).To(ContainElement(And(
+			HavePrefix("GIT_SSH_COMMAND="),
+			ContainSubstring("StrictHostKeyChecking=yes"),
+			ContainSubstring("UserKnownHostsFile="+filepath.Join(dir, "known_hosts")),
+			Not(ContainSubstring("/dev/null")),
+		)))
+	})
+
+	It("does not need known_hosts for HTTPS", func() {
+		repo := repository{url: "https://example.com/org/site.git", username: "u", password: "p"}
+		Expect(repo.validate()).To(Succeed())
+		env, err := repo.gitEnv(GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(env).NotTo(ContainElement(HavePrefix("GIT_SSH_COMMAND=")))
+	})
+})
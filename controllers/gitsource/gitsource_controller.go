@@ -0,0 +1,295 @@
+package gitsource
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+)
+
+// Reconciler reconciles a GitSource object
+type Reconciler struct {
+	client.Client
+	Scheme *runtime.Scheme
+}
+
+const (
+	// gitSourceLabel is set on pages materialized from a GitSource, value is the GitSource name
+	gitSourceLabel = "webid.golang.betsys.com/gitsource"
+	// pathAnnotation is set on pages materialized from a GitSource, value is the path of the file in repository
+	pathAnnotation = "webid.golang.betsys.com/path"
+
+	// secretKey indexes GitSources by the name of their credentials Secret
+	secretKey = "spec.secretRef"
+
+	typeSynced = "Synced"
+
+	defaultInterval = 5 * time.Minute
+)
+
+// validPageName matches file names, that can be published as a page
+var validPageName = regexp.MustCompile(`^[-._a-zA-Z0-9]+$`)
+
+//+kubebuilder:rbac:groups=webid.golang.betsys.com,resources=gitsources,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=webid.golang.betsys.com,resources=gitsources/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=webid.golang.betsys.com,resources=gitsources/finalizers,verbs=update
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
+
+// Reconcile fetches the git repository and materializes its files as Pages of the WebServer,
+// the repository is polled in spec.interval.
+func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+	debug := log.V(1).Info
+
+	// Get the GitSource object
+	gs := &webidv1alpha1.GitSource{}
+	if err := r.Get(ctx, req.NamespacedName, gs); err != nil {
+		if apierrors.IsNotFound(err) {
+			log.Info("GitSource resource not found. Ignoring since object must be deleted")
+			return ctrl.Result{}, nil
+		}
+		log.Error(err, "Failed to get GitSource")
+		return ctrl.Result{}, err
+	}
+	debug("Reconcile: got object:", "gitsource", gs.Name)
+
+	if gs.Spec.Paused {
+		debug("GitSource is paused")
+		return ctrl.Result{}, r.setStatus(ctx, gs, metav1.ConditionUnknown, "Paused", "Updates are paused")
+	}
+
+	interval := gs.Spec.Interval.Duration
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+
+	repo, err := r.repository(ctx, gs)
+	if err != nil {
+		return ctrl.Result{RequeueAfter: interval}, r.setStatus(ctx, gs, metav1.ConditionFalse, "CredentialsNotFound", err.Error())
+	}
+	if err = repo.validate(); err != nil {
+		return ctrl.Result{RequeueAfter: interval}, r.setStatus(ctx, gs, metav1.ConditionFalse, "KnownHostsMissing", err.Error())
+	}
+
+	snap, err := fetch(ctx, repo)
+	if err != nil {
+		log.Error(err, "Failed to fetch repository", "url", gs.Spec.URL)
+		return ctrl.Result{RequeueAfter: interval}, r.setStatus(ctx, gs, metav1.ConditionFalse, "FetchFailed", err.Error())
+	}
+
+	if err = r.syncPages(ctx, gs, snap.files); err != nil {
+		log.Error(err, "Failed to materialize pages")
+		if errStat := r.setStatus(ctx, gs, metav1.ConditionFalse, "SyncFailed", err.Error()); errStat != nil {
+			log.Error(errStat, "failed to set status")
+		}
+		return ctrl.Result{}, err
+	}
+
+	gs.Status.Commit = snap.commit
+	gs.Status.LastSyncTime = &metav1.Time{Time: time.Now()}
+	message := "Published commit " + snap.commit
+	if len(gs.Status.Collisions) > 0 {
+		message += fmt.Sprintf(", %d files skipped because of page name collisions", len(gs.Status.Collisions))
+	}
+	if err = r.setStatus(ctx, gs, metav1.ConditionTrue, "Synced", message); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	debug("Reconcile: completed", "commit", snap.commit)
+	return ctrl.Result{RequeueAfter: interval}, nil
+}
+
+// repository returns the repository to fetch, including credentials from spec.secretRef
+func (r *Reconciler) repository(ctx context.Context, gs *webidv1alpha1.GitSource) (repository, error) {
+	repo := repository{url: gs.Spec.URL, ref: gs.Spec.Ref, directory: gs.Spec.Directory}
+	if gs.Spec.SecretRef == nil {
+		return repo, nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: gs.Namespace, Name: gs.Spec.SecretRef.Name}, secret); err != nil {
+		return repo, err
+	}
+	repo.username = string(secret.Data[corev1.BasicAuthUsernameKey])
+	repo.password = string(secret.Data[corev1.BasicAuthPasswordKey])
+	repo.sshKey = secret.Data[corev1.SSHAuthPrivateKey]
+	repo.knownHosts = secret.Data["known_hosts"]
+	return repo, nil
+}
+
+// syncPages creates/updates a Page for each file, pages of files removed from the repository are deleted.
+// If several files map to the same page name, the first one (by path) is published and the others are reported
+// in status.collisions.
+func (r *Reconciler) syncPages(ctx context.Context, gs *webidv1alpha1.GitSource, files map[string][]byte) error {
+	log := log.FromContext(ctx)
+
+	existing := &webidv1alpha1.PageList{}
+	if err := r.List(ctx, existing, client.InNamespace(gs.Namespace), client.MatchingLabels{gitSourceLabel: gs.Name}); err != nil {
+		return err
+	}
+	current := make(map[string]*webidv1alpha1.Page, len(existing.Items))
+	for i := range existing.Items {
+		current[existing.Items[i].Name] = &existing.Items[i]
+	}
+
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	published := make(map[string]string, len(paths)) // page name -> path
+	gs.Status.Collisions = nil
+
+	for _, path := range paths {
+		page, ok := r.desiredPage(gs, path, files[path])
+		if !ok {
+			log.Info("Skipping file, its name can not be published", "path", path)
+			continue
+		}
+		if other, taken := published[page.Spec.Name]; taken {
+			log.Info("Skipping file, its page name is used by another file", "path", path, "other", other)
+			gs.Status.Collisions = append(gs.Status.Collisions,
+				fmt.Sprintf("%s: page name %q is used by %s", path, page.Spec.Name, other))
+			continue
+		}
+		published[page.Spec.Name] = path
+
+		old, exists := current[page.Name]
+		delete(current, page.Name)
+		if !exists {
+			if err := ctrl.SetControllerReference(gs, page, r.Scheme); err != nil {
+				return err
+			}
+			log.Info("Creating a new Page", "namespace", page.Namespace, "name", page.Name, "path", path)
+			if err := r.Create(ctx, page); err != nil {
+				return err
+			}
+			continue
+		}
+		page.Spec.RevisionHistoryLimit = old.Spec.RevisionHistoryLimit // defaulted by the API server
+		if !reflect.DeepEqual(old.Spec, page.Spec) {
+			log.Info("Updating Page", "namespace", old.Namespace, "name", old.Name, "path", path)
+			old.Spec = page.Spec
+			if err := r.Update(ctx, old); err != nil {
+				return err
+			}
+		}
+	}
+
+	// pages of files that are no longer in the repository
+	for _, page := range current {
+		log.Info("Deleting Page", "namespace", page.Namespace, "name", page.Name)
+		if err := r.Delete(ctx, page); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// desiredPage returns the page for the file, false if the file can not be published
+// (nested paths are flattened, e.g. 'docs/intro.html' is published as 'docs-intro.html')
+func (r *Reconciler) desiredPage(gs *webidv1alpha1.GitSource, path string, data []byte) (*webidv1alpha1.Page, bool) {
+	name := strings.ReplaceAll(path, "/", "-")
+	if !validPageName.MatchString(name) {
+		return nil, false
+	}
+
+	h := sha1.Sum([]byte(path))
+	page := &webidv1alpha1.Page{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        gs.Name + "-" + hex.EncodeToString(h[:])[:10],
+			Namespace:   gs.Namespace,
+			Labels:      map[string]string{gitSourceLabel: gs.Name},
+			Annotations: map[string]string{pathAnnotation: path},
+		},
+		Spec: webidv1alpha1.PageSpec{
+			WebServer: gs.Spec.WebServer,
+			Name:      name,
+		},
+	}
+	if utf8.Valid(data) {
+		page.Spec.Contents = string(data)
+	} else {
+		page.Spec.Binary = data
+	}
+	return page, true
+}
+
+// setStatus updates the Synced condition (and the rest of the status) of the GitSource
+func (r *Reconciler) setStatus(ctx context.Context, gs *webidv1alpha1.GitSource,
+	status metav1.ConditionStatus, reason, message string,
+) error {
+	meta.SetStatusCondition(&gs.Status.Conditions, metav1.Condition{Type: typeSynced, Status: status,
+		Reason: reason, Message: message, ObservedGeneration: gs.Generation})
+	if err := r.Status().Update(ctx, gs); err != nil {
+		if !apierrors.IsConflict(err) {
+			log.FromContext(ctx).Error(err, "Failed to update GitSource status")
+		}
+		return err
+	}
+	return nil
+}
+
+// gitSourcesOfSecret maps a Secret to the GitSources using it for credentials (using index)
+func (r *Reconciler) gitSourcesOfSecret(obj client.Object) []reconcile.Request {
+	ctx := context.Background()
+	list := &webidv1alpha1.GitSourceList{}
+	opts := []client.ListOption{
+		client.InNamespace(obj.GetNamespace()),
+		client.MatchingFields{secretKey: obj.GetName()},
+	}
+	if err := r.List(ctx, list, opts...); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list gitsources", "index", secretKey, "name", obj.GetName())
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(list.Items))
+	for _, gs := range list.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: gs.Namespace, Name: gs.Name}})
+	}
+	return requests
+}
+
+// SetupWithManager sets up the controller with the Manager.
+// Status updates are ignored. The owned pages are not watched - each sync clones the repository, so pages changed
+// manually are restored at the next interval (the controller's own page updates would requeue it otherwise).
+// Create a new index "spec.secretRef" in the cache, so that the repository is fetched again when its credentials change.
+func (r *Reconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &webidv1alpha1.GitSource{}, secretKey,
+		func(rawObj client.Object) []string {
+			gs := rawObj.(*webidv1alpha1.GitSource)
+			if gs.Spec.SecretRef == nil {
+				return nil
+			}
+			return []string{gs.Spec.SecretRef.Name}
+		}); err != nil {
+		return err
+	}
+
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&webidv1alpha1.GitSource{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&source.Kind{Type: &corev1.Secret{}}, handler.EnqueueRequestsFromMapFunc(r.gitSourcesOfSecret)).
+		Complete(r)
+}
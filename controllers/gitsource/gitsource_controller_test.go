@@ -0,0 +1,67 @@
+package gitsource
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+)
+
+var _ = Describe("syncPages", func() {
+	var (
+		r  *Reconciler
+		gs *webidv1alpha1.GitSource
+	)
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(webidv1alpha1.AddToScheme(scheme)).To(Succeed())
+		gs = &webidv1alpha1.GitSource{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "docs", UID: "uid"},
+			Spec:       webidv1alpha1.GitSourceSpec{WebServer: "web", URL: "https://example.com/docs.git"},
+		}
+		r = &Reconciler{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(gs).Build(), Scheme: scheme}
+	})
+
+	pageNames := func() map[string]string {
+		list := &webidv1alpha1.PageList{}
+		Expect(r.List(context.Background(), list, client.InNamespace("ns"))).To(Succeed())
+		names := make(map[string]string)
+		for _, page := range list.Items {
+			names[page.Spec.Name] = page.Annotations[pathAnnotation]
+		}
+		return names
+	}
+
+	It("flattens nested paths", func() {
+		Expect(r.syncPages(context.Background(), gs, map[string][]byte{
+			"index.html":     []byte("<h1>home</h1>"),
+			"docs/intro.htm": []byte("<h1>intro</h1>"),
+			"bad name.html":  []byte("skipped"),
+		})).To(Succeed())
+		Expect(pageNames()).To(Equal(map[string]string{"index.html": "index.html", "docs-intro.htm": "docs/intro.htm"}))
+		Expect(gs.Status.Collisions).To(BeEmpty())
+	})
+
+	It("publishes the first of colliding files and reports the others", func() {
+		Expect(r.syncPages(context.Background(), gs, map[string][]byte{
+			"a/b.html": []byte("nested"),
+			"a-b.html": []byte("flat"),
+		})).To(Succeed())
+		Expect(pageNames()).To(Equal(map[string]string{"a-b.html": "a-b.html"}))
+		Expect(gs.Status.Collisions).To(Equal([]string{`a/b.html: page name "a-b.html" is used by a-b.html`}))
+	})
+
+	It("deletes pages of removed files", func() {
+		Expect(r.syncPages(context.Background(), gs, map[string][]byte{"a.html": []byte("a"), "b.html": []byte("b")})).To(Succeed())
+		Expect(r.syncPages(context.Background(), gs, map[string][]byte{"a.html": []byte("a2")})).To(Succeed())
+		Expect(pageNames()).To(Equal(map[string]string{"a.html": "a.html"}))
+	})
+})
@@ -0,0 +1,195 @@
+package pages
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+)
+
+// webServerNamespaceKey is the page index key of the namespace of the referenced WebServer
+const webServerNamespaceKey = "spec.webserverNamespace"
+
+const (
+	typeReferenceGranted = "ReferenceGranted"
+	reasonNotGranted     = "NotGranted"
+)
+
+// WebServerRef returns the namespaced name of the WebServer the page shall be published into
+func WebServerRef(page *webidv1alpha1.Page) types.NamespacedName {
+	ns := page.Spec.WebServerNamespace
+	if ns == "" {
+		ns = page.Namespace
+	}
+	return types.NamespacedName{Namespace: ns, Name: page.Spec.WebServer}
+}
+
+// grants holds PageGrants of one type in a namespace, it checks whether pages from other namespaces may be published
+// into a web server (Publish grants in the namespace of the web server), or selected by a web server from other
+// namespace (Select grants in the namespace of the page)
+type grants struct {
+	client   client.Client
+	typ      webidv1alpha1.PageGrantType
+	items    []webidv1alpha1.PageGrant
+	nsLabels map[string]labels.Set
+}
+
+// listGrants returns PageGrants of the type in the namespace
+func listGrants(ctx context.Context, c client.Client, namespace string, typ webidv1alpha1.PageGrantType) (*grants, error) {
+	list := &webidv1alpha1.PageGrantList{}
+	if err := c.List(ctx, list, client.InNamespace(namespace)); err != nil {
+		return nil, err
+	}
+	g := &grants{client: c, typ: typ, nsLabels: make(map[string]labels.Set)}
+	for _, grant := range list.Items {
+		if grantType(&grant) == typ {
+			g.items = append(g.items, grant)
+		}
+	}
+	return g, nil
+}
+
+// grantType returns the type of the grant, Publish if not set
+func grantType(grant *webidv1alpha1.PageGrant) webidv1alpha1.PageGrantType {
+	if grant.Spec.Type == "" {
+		return webidv1alpha1.PageGrantPublish
+	}
+	return grant.Spec.Type
+}
+
+// grantsOf returns Publish PageGrants in the namespace of the web server
+func (r *Reconciler) grantsOf(ctx context.Context, web types.NamespacedName) (*grants, error) {
+	return listGrants(ctx, r.Client, web.Namespace, webidv1alpha1.PageGrantPublish)
+}
+
+// allows returns true if the page may be published into (Publish) or selected by (Select) the web server:
+// it is in the same namespace, or a PageGrant allows the namespace of the page (Publish) or of the web server (Select)
+func (g *grants) allows(ctx context.Context, web types.NamespacedName, page *webidv1alpha1.Page) (bool, error) {
+	if page.Namespace == web.Namespace {
+		return true, nil
+	}
+	namespace := page.Namespace
+	if g.typ == webidv1alpha1.PageGrantSelect {
+		namespace = web.Namespace
+	}
+	for _, grant := range g.items {
+		if grant.Spec.WebServer != "" && grant.Spec.WebServer != web.Name {
+			continue
+		}
+		for _, from := range grant.Spec.From {
+			if from.Namespace == namespace {
+				return true, nil
+			}
+			if from.NamespaceSelector == nil {
+				continue
+			}
+			selector, err := metav1.LabelSelectorAsSelector(from.NamespaceSelector)
+			if err != nil {
+				log.FromContext(ctx).Error(err, "Invalid namespace selector", "pagegrant", grant.Name)
+				continue
+			}
+			nsLabels, err := g.namespaceLabels(ctx, namespace)
+			if err != nil {
+				return false, err
+			}
+			if selector.Matches(nsLabels) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// namespaceLabels returns labels of the namespace
+func (g *grants) namespaceLabels(ctx context.Context, name string) (labels.Set, error) {
+	if l, ok := g.nsLabels[name]; ok {
+		return l, nil
+	}
+	ns := &corev1.Namespace{}
+	if err := g.client.Get(ctx, types.NamespacedName{Name: name}, ns); err != nil {
+		return nil, err
+	}
+	g.nsLabels[name] = ns.Labels
+	return ns.Labels, nil
+}
+
+// checkGrant sets the ReferenceGranted condition of the page, returns false if the reference is not granted
+func (r *Reconciler) checkGrant(ctx context.Context, page *webidv1alpha1.Page) (bool, error) {
+	web := WebServerRef(page)
+	g, err := r.grantsOf(ctx, web)
+	if err != nil {
+		return false, err
+	}
+	allowed, err := g.allows(ctx, web, page)
+	if err != nil {
+		return false, err
+	}
+
+	condition := metav1.Condition{Type: typeReferenceGranted, Status: metav1.ConditionTrue,
+		Reason: "Granted", Message: "Reference to WebServer allowed"}
+	if !allowed {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = reasonNotGranted
+		condition.Message = fmt.Sprintf("no PageGrant in namespace %q allows pages from namespace %q to be published into WebServer %q",
+			web.Namespace, page.Namespace, web.Name)
+	}
+	return allowed, r.setCondition(ctx, page, condition)
+}
+
+// pagesOfGrant maps a PageGrant to the pages from other namespaces, that reference web servers in its namespace
+// (Publish), or to the pages in its namespace, that may be selected by web servers from other namespaces (Select)
+func (r *Reconciler) pagesOfGrant(obj client.Object) []reconcile.Request {
+	ctx := context.Background()
+	list := &webidv1alpha1.PageList{}
+	if grantType(obj.(*webidv1alpha1.PageGrant)) == webidv1alpha1.PageGrantSelect {
+		if err := r.List(ctx, list, client.InNamespace(obj.GetNamespace())); err != nil {
+			log.FromContext(ctx).Error(err, "Failed to list pages", "namespace", obj.GetNamespace())
+			return nil
+		}
+	} else if err := r.List(ctx, list, client.MatchingFields{webServerNamespaceKey: obj.GetNamespace()}); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list pages", "index", webServerNamespaceKey, "name", obj.GetNamespace())
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(list.Items))
+	for _, page := range list.Items {
+		// pages referencing a web server in the namespace of the grant do not need it
+		if page.Namespace == obj.GetNamespace() && page.Spec.WebServer != "" {
+			continue
+		}
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: page.Namespace, Name: page.Name},
+		})
+	}
+	return requests
+}
+
+// pagesOfWebServer maps a WebServer to its pages (in any namespace, using index, and selected by spec.pageSelector)
+func (r *Reconciler) pagesOfWebServer(obj client.Object) []reconcile.Request {
+	ctx := context.Background()
+	web := types.NamespacedName{Namespace: obj.GetNamespace(), Name: obj.GetName()}
+	list := &webidv1alpha1.PageList{}
+	if err := r.List(ctx, list, client.MatchingFields{WebServerKey: web.String()}); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list pages", "index", WebServerKey, "name", web.String())
+		return nil
+	}
+	selected, err := r.selectedPages(ctx, obj.(*webidv1alpha1.WebServer))
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list selected pages", "webserver", web.String())
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(list.Items)+len(selected))
+	for _, page := range append(list.Items, selected...) {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: page.Namespace, Name: page.Name},
+		})
+	}
+	return requests
+}
@@ -0,0 +1,131 @@
+package pages
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+)
+
+var _ = Describe("PageGrant", func() {
+	ctx := context.Background()
+	webKey := types.NamespacedName{Namespace: "docs", Name: "public"}
+	var page *webidv1alpha1.Page
+
+	web := &webidv1alpha1.WebServer{ObjectMeta: metav1.ObjectMeta{Namespace: "docs", Name: "public"}}
+	namespace := func(name string, labels map[string]string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+	}
+	grant := func(namespace string, spec webidv1alpha1.PageGrantSpec) *webidv1alpha1.PageGrant {
+		return &webidv1alpha1.PageGrant{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "grant"}, Spec: spec}
+	}
+	fromTeam := []webidv1alpha1.PageGrantFrom{{Namespace: "team"}}
+	newReconciler := func(objs ...client.Object) *Reconciler {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(webidv1alpha1.AddToScheme(scheme)).To(Succeed())
+		objs = append(objs, namespace("docs", nil), namespace("team", map[string]string{"docs": "true"}), web, page)
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).
+			WithIndex(&webidv1alpha1.Page{}, WebServerKey, func(obj client.Object) []string {
+				return []string{WebServerRef(obj.(*webidv1alpha1.Page)).String()}
+			}).
+			WithIndex(&webidv1alpha1.Page{}, webServerNamespaceKey, func(obj client.Object) []string {
+				return []string{WebServerRef(obj.(*webidv1alpha1.Page)).Namespace}
+			}).
+			WithIndex(&webidv1alpha1.WebServer{}, PageSelectorKey, selectedNamespaces).Build()
+		return &Reconciler{Client: c, Scheme: scheme,
+			Data: make(map[types.NamespacedName]PageData), Info: make(map[types.NamespacedName]PageInfo)}
+	}
+	// published returns the pages of the web server and whether the page file is published
+	published := func(r *Reconciler) ([]string, bool) {
+		prepared, err := r.PrepareData(ctx, web)
+		Expect(err).NotTo(HaveOccurred())
+		_, ok := r.GetData(webKey)["index.html"]
+		return prepared.Pages, ok
+	}
+	// granted checks the grant of the page and returns its ReferenceGranted condition
+	granted := func(r *Reconciler) (bool, *metav1.Condition) {
+		ok, err := r.checkGrant(ctx, page)
+		Expect(err).NotTo(HaveOccurred())
+		stored := &webidv1alpha1.Page{}
+		Expect(r.Get(ctx, client.ObjectKeyFromObject(page), stored)).To(Succeed())
+		return ok, meta.FindStatusCondition(stored.Status.Conditions, typeReferenceGranted)
+	}
+
+	BeforeEach(func() {
+		page = &webidv1alpha1.Page{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: "index"},
+			Spec: webidv1alpha1.PageSpec{WebServer: "public", WebServerNamespace: "docs",
+				Name: "index.html", Contents: "<p>team</p>"},
+		}
+	})
+
+	It("denies a page from another namespace without a grant", func() {
+		r := newReconciler()
+		ok, condition := granted(r)
+		Expect(ok).To(BeFalse())
+		Expect(condition.Status).To(Equal(metav1.ConditionFalse))
+		Expect(condition.Reason).To(Equal(reasonNotGranted))
+
+		pages, found := published(r)
+		Expect(pages).To(BeEmpty())
+		Expect(found).To(BeFalse())
+	})
+
+	DescribeTable("publishes a page allowed by a grant in the namespace of the web server",
+		func(spec webidv1alpha1.PageGrantSpec, allowed bool) {
+			r := newReconciler(grant("docs", spec))
+			ok, condition := granted(r)
+			Expect(ok).To(Equal(allowed))
+			Expect(condition.Status == metav1.ConditionTrue).To(Equal(allowed))
+			_, found := published(r)
+			Expect(found).To(Equal(allowed))
+		},
+		Entry("namespace", webidv1alpha1.PageGrantSpec{From: fromTeam}, true),
+		Entry("namespace selector", webidv1alpha1.PageGrantSpec{From: []webidv1alpha1.PageGrantFrom{
+			{NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"docs": "true"}}}}}, true),
+		Entry("the web server", webidv1alpha1.PageGrantSpec{WebServer: "public", From: fromTeam}, true),
+		Entry("other namespace", webidv1alpha1.PageGrantSpec{From: []webidv1alpha1.PageGrantFrom{{Namespace: "other"}}}, false),
+		Entry("not matching selector", webidv1alpha1.PageGrantSpec{From: []webidv1alpha1.PageGrantFrom{
+			{NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"docs": "false"}}}}}, false),
+		Entry("other web server", webidv1alpha1.PageGrantSpec{WebServer: "internal", From: fromTeam}, false),
+	)
+
+	It("ignores a grant in the wrong namespace", func() {
+		r := newReconciler(grant("team", webidv1alpha1.PageGrantSpec{From: []webidv1alpha1.PageGrantFrom{{Namespace: "team"}}}))
+		ok, _ := granted(r)
+		Expect(ok).To(BeFalse())
+		_, found := published(r)
+		Expect(found).To(BeFalse())
+	})
+
+	It("unpublishes the page when the grant is revoked", func() {
+		g := grant("docs", webidv1alpha1.PageGrantSpec{From: fromTeam})
+		r := newReconciler(g)
+		pages, found := published(r)
+		Expect(pages).To(Equal([]string{"team/index"}))
+		Expect(found).To(BeTrue())
+
+		Expect(r.pagesOfGrant(g)).To(ConsistOf(reconcile.Request{NamespacedName: client.ObjectKeyFromObject(page)}))
+		Expect(r.Delete(ctx, g)).To(Succeed())
+
+		ok, condition := granted(r)
+		Expect(ok).To(BeFalse())
+		Expect(condition.Reason).To(Equal(reasonNotGranted))
+		pages, found = published(r)
+		Expect(pages).To(BeEmpty())
+		Expect(found).To(BeFalse())
+	})
+})
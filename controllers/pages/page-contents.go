@@ -0,0 +1,268 @@
+package pages
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"path/filepath"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+)
+
+// Page index keys of ConfigMaps/Secrets referenced in spec.contentsFrom
+const (
+	ConfigMapKey = "spec.contentsFrom.configMap"
+	SecretKey    = "spec.contentsFrom.secret"
+)
+
+const (
+	reasonReferenceNotFound = "ReferenceNotFound"
+	reasonTemplateError     = "TemplateError"
+	reasonInvalidSpec       = "InvalidSpec"
+	reasonSanitizeFailed    = "SanitizeFailed"
+)
+
+// pageError is returned when the page can not be published, e.g. when an object (or its key)
+// referenced by spec.contentsFrom does not exist. Reason is used in the page status condition.
+type pageError struct {
+	reason string
+	msg    string
+}
+
+func (e *pageError) Error() string { return e.msg }
+
+func missingRef(format string, args ...any) *pageError {
+	return &pageError{reason: reasonReferenceNotFound, msg: fmt.Sprintf(format, args...)}
+}
+
+func isMissingRef(err error) bool {
+	e, ok := err.(*pageError)
+	return ok && e.reason == reasonReferenceNotFound
+}
+
+func isPageError(err error) bool {
+	_, ok := err.(*pageError)
+	return ok
+}
+
+// pageFiles returns the files published by the page and their info (see sourceFiles), templates are rendered with td.
+// It returns pageError if the page can not be published (missing reference, template error).
+func (r *Reconciler) pageFiles(ctx context.Context, page *webidv1alpha1.Page, td *templateData) (PageData, PageInfo, error) {
+	data, info, err := r.sourceFiles(ctx, page)
+	if err != nil || !page.Spec.Template {
+		return data, info, err
+	}
+	if data, err = td.renderFiles(page, data); err != nil {
+		return nil, nil, err
+	}
+	return data, info, nil
+}
+
+// sourceFiles returns the files of the page before rendering and their info. The contents are taken either from
+// the page itself, or from the ConfigMap/Secret referenced in spec.contentsFrom.
+// If spec.revision is set, the stored revision is returned instead.
+func (r *Reconciler) sourceFiles(ctx context.Context, page *webidv1alpha1.Page) (PageData, PageInfo, error) {
+	if err := validatePage(page); err != nil {
+		return nil, nil, err
+	}
+	if page.Spec.Revision != "" {
+		return r.revisionFiles(ctx, page, page.Spec.Revision)
+	}
+	return r.pageSource(ctx, page)
+}
+
+// InvalidHeaderChars can not be used in the header values rendered quoted into the nginx config
+const InvalidHeaderChars = "\"\\$\r\n"
+
+// validatePage checks the page spec, that is validated by the API server since it was created
+// (older pages are validated here), it returns pageError if the page can not be published
+func validatePage(page *webidv1alpha1.Page) error {
+	if page.Spec.Name == "." || page.Spec.Name == ".." {
+		return &pageError{reason: reasonInvalidSpec, msg: fmt.Sprintf("%q is not a valid page name", page.Spec.Name)}
+	}
+	if len(page.Spec.Binary) > 0 && page.Spec.Contents != "" {
+		return &pageError{reason: reasonInvalidSpec, msg: "binary and contents are mutually exclusive"}
+	}
+	if strings.ContainsAny(page.Spec.ContentSecurityPolicy, InvalidHeaderChars) {
+		return &pageError{reason: reasonInvalidSpec, msg: "invalid contentSecurityPolicy"}
+	}
+	if src := page.Spec.ContentsFrom; src != nil {
+		sources := 0
+		for _, set := range []bool{src.ConfigMapKeyRef != nil, src.SecretKeyRef != nil, src.ConfigMapRef != nil} {
+			if set {
+				sources++
+			}
+		}
+		if sources != 1 {
+			return &pageError{reason: reasonInvalidSpec,
+				msg: "exactly one of configMapKeyRef, secretKeyRef and configMapRef must be set in contentsFrom"}
+		}
+	}
+	return nil
+}
+
+// pageSource returns the files of the page, the contents are taken either from the page itself,
+// or from the ConfigMap/Secret referenced in spec.contentsFrom
+func (r *Reconciler) pageSource(ctx context.Context, page *webidv1alpha1.Page) (PageData, PageInfo, error) {
+	src := page.Spec.ContentsFrom
+	if src == nil {
+		return PageData{page.Spec.Name: pageContents(page)},
+			PageInfo{page.Spec.Name: FileInfo{ContentType: contentType(page)}}, nil
+	}
+
+	single := func(contents []byte) (PageData, PageInfo, error) {
+		return PageData{page.Spec.Name: contents},
+			PageInfo{page.Spec.Name: FileInfo{ContentType: page.Spec.ContentType}}, nil
+	}
+
+	switch {
+	case src.ConfigMapKeyRef != nil:
+		ref := src.ConfigMapKeyRef
+		cm := &corev1.ConfigMap{}
+		if err := r.getRef(ctx, page.Namespace, ref.Name, cm); err != nil {
+			return optionalRef(ref.Optional, err)
+		}
+		if v, ok := cm.Data[ref.Key]; ok {
+			return single([]byte(v))
+		}
+		if v, ok := cm.BinaryData[ref.Key]; ok {
+			return single(v)
+		}
+		return optionalRef(ref.Optional, missingRef("key %q not found in ConfigMap %q", ref.Key, ref.Name))
+
+	case src.SecretKeyRef != nil:
+		ref := src.SecretKeyRef
+		secret := &corev1.Secret{}
+		if err := r.getRef(ctx, page.Namespace, ref.Name, secret); err != nil {
+			return optionalRef(ref.Optional, err)
+		}
+		if v, ok := secret.Data[ref.Key]; ok {
+			return single(v)
+		}
+		return optionalRef(ref.Optional, missingRef("key %q not found in Secret %q", ref.Key, ref.Name))
+
+	case src.ConfigMapRef != nil:
+		cm := &corev1.ConfigMap{}
+		if err := r.getRef(ctx, page.Namespace, src.ConfigMapRef.Name, cm); err != nil {
+			return optionalRef(src.ConfigMapRef.Optional, err)
+		}
+		data := make(PageData)
+		info := make(PageInfo)
+		for k, v := range cm.Data {
+			data[k] = []byte(v)
+			info[k] = FileInfo{}
+		}
+		for k, v := range cm.BinaryData {
+			data[k] = v
+			info[k] = FileInfo{}
+		}
+		return data, info, nil
+	}
+	return nil, nil, &pageError{reason: reasonInvalidSpec, msg: "contentsFrom does not define any source"}
+}
+
+// pageContents returns the data to be published for the page - binary asset or HTML contents
+func pageContents(page *webidv1alpha1.Page) []byte {
+	if len(page.Spec.Binary) > 0 {
+		return page.Spec.Binary
+	}
+	return []byte(page.Spec.Contents)
+}
+
+// contentType returns the explicit MIME type of the page:
+// - spec.contentType if set
+// - for binary assets, the type derived from the name extension
+// - empty string otherwise (served as nginx default)
+func contentType(page *webidv1alpha1.Page) string {
+	if page.Spec.ContentType != "" {
+		return page.Spec.ContentType
+	}
+	if len(page.Spec.Binary) == 0 {
+		return ""
+	}
+	ct, _, err := mime.ParseMediaType(mime.TypeByExtension(filepath.Ext(page.Spec.Name)))
+	if err != nil {
+		return "application/octet-stream"
+	}
+	return ct
+}
+
+// getRef gets the object referenced by the page, NotFound is converted to pageError
+func (r *Reconciler) getRef(ctx context.Context, namespace, name string, obj client.Object) error {
+	if err := r.Get(ctx, types.NamespacedName{Namespace: namespace, Name: name}, obj); err != nil {
+		if apierrors.IsNotFound(err) {
+			kind := "ConfigMap"
+			if _, ok := obj.(*corev1.Secret); ok {
+				kind = "Secret"
+			}
+			return missingRef("%s %q not found", kind, name)
+		}
+		return err
+	}
+	return nil
+}
+
+// optionalRef ignores missing reference if it is optional
+func optionalRef(optional *bool, err error) (PageData, PageInfo, error) {
+	if isMissingRef(err) && optional != nil && *optional {
+		return PageData{}, PageInfo{}, nil
+	}
+	return nil, nil, err
+}
+
+// referencedConfigMaps is an index function returning names of ConfigMaps referenced by a page
+func referencedConfigMaps(rawObj client.Object) []string {
+	src := rawObj.(*webidv1alpha1.Page).Spec.ContentsFrom
+	if src == nil {
+		return nil
+	}
+	var names []string
+	if src.ConfigMapKeyRef != nil {
+		names = append(names, src.ConfigMapKeyRef.Name)
+	}
+	if src.ConfigMapRef != nil {
+		names = append(names, src.ConfigMapRef.Name)
+	}
+	return names
+}
+
+// referencedSecrets is an index function returning names of Secrets referenced by a page
+func referencedSecrets(rawObj client.Object) []string {
+	src := rawObj.(*webidv1alpha1.Page).Spec.ContentsFrom
+	if src == nil || src.SecretKeyRef == nil {
+		return nil
+	}
+	return []string{src.SecretKeyRef.Name}
+}
+
+// pagesReferencing returns a map function, that maps a ConfigMap/Secret to the pages referencing it (using index)
+func (r *Reconciler) pagesReferencing(indexKey string) handler.MapFunc {
+	return func(obj client.Object) []reconcile.Request {
+		ctx := context.Background()
+		list := &webidv1alpha1.PageList{}
+		opts := []client.ListOption{
+			client.InNamespace(obj.GetNamespace()),
+			client.MatchingFields{indexKey: obj.GetName()},
+		}
+		if err := r.List(ctx, list, opts...); err != nil {
+			log.FromContext(ctx).Error(err, "Failed to list pages", "index", indexKey, "name", obj.GetName())
+			return nil
+		}
+		requests := make([]reconcile.Request, 0, len(list.Items))
+		for _, page := range list.Items {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Namespace: page.Namespace, Name: page.Name},
+			})
+		}
+		return requests
+	}
+}
@@ -0,0 +1,139 @@
+package pages
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+)
+
+var _ = Describe("page contents", func() {
+	page := func(name, contents string, binary []byte) *webidv1alpha1.Page {
+		return &webidv1alpha1.Page{Spec: webidv1alpha1.PageSpec{Name: name, Contents: contents, Binary: binary}}
+	}
+
+	withCSP := func(p *webidv1alpha1.Page, csp string) *webidv1alpha1.Page {
+		p.Spec.ContentSecurityPolicy = csp
+		return p
+	}
+
+	DescribeTable("validatePage",
+		func(p *webidv1alpha1.Page, valid bool) {
+			err := validatePage(p)
+			if valid {
+				Expect(err).NotTo(HaveOccurred())
+				return
+			}
+			Expect(err).To(HaveOccurred())
+			Expect(isPageError(err)).To(BeTrue())
+			Expect(err.(*pageError).reason).To(Equal(reasonInvalidSpec))
+		},
+		Entry("contents", page("index.html", "<h1>hi</h1>", nil), true),
+		Entry("binary", page("logo.png", "", []byte{1, 2}), true),
+		Entry("dot", page(".", "x", nil), false),
+		Entry("dot dot", page("..", "x", nil), false),
+		Entry("binary and contents", page("logo.png", "x", []byte{1}), false),
+		Entry("content security policy", withCSP(page("index.html", "x", nil), "default-src 'self'"), true),
+		Entry("line break in content security policy",
+			withCSP(page("index.html", "x", nil), "default-src 'self'\r\nSet-Cookie: a=b"), false),
+		Entry("quote in content security policy", withCSP(page("index.html", "x", nil), `a" always; b "`), false),
+	)
+
+	DescribeTable("contentType",
+		func(p *webidv1alpha1.Page, explicit, expected string) {
+			p.Spec.ContentType = explicit
+			Expect(contentType(p)).To(Equal(expected))
+		},
+		Entry("HTML page is served as nginx default", page("index.html", "x", nil), "", ""),
+		Entry("explicit type", page("data", "{}", nil), "application/json", "application/json"),
+		Entry("binary by extension", page("logo.png", "", []byte{1}), "", "image/png"),
+		Entry("binary with unknown extension", page("blob.unknownext", "", []byte{1}), "", "application/octet-stream"),
+	)
+
+	It("publishes binary contents instead of HTML", func() {
+		Expect(pageContents(page("logo.png", "", []byte{1, 2}))).To(Equal([]byte{1, 2}))
+		Expect(pageContents(page("index.html", "<p>", nil))).To(Equal([]byte("<p>")))
+	})
+
+	Describe("contentsFrom", func() {
+		var r *Reconciler
+
+		BeforeEach(func() {
+			cm := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "site"},
+				Data:       map[string]string{"index.html": "<h1>site</h1>", "style.css": "h1 {}"},
+			}
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "private"},
+				Data:       map[string][]byte{"page": []byte("secret")},
+			}
+			r = &Reconciler{Client: fake.NewClientBuilder().WithObjects(cm, secret).Build()}
+		})
+
+		source := func(src *webidv1alpha1.ContentsSource) (PageData, PageInfo, error) {
+			p := page("page.html", "", nil)
+			p.Namespace = "ns"
+			p.Spec.ContentsFrom = src
+			if err := validatePage(p); err != nil {
+				return nil, nil, err
+			}
+			return r.pageSource(context.Background(), p)
+		}
+		optional := true
+		keyRef := func(name, key string, opt *bool) *corev1.ConfigMapKeySelector {
+			return &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: name}, Key: key, Optional: opt}
+		}
+		cmRef := func(name string, opt *bool) *webidv1alpha1.ConfigMapReference {
+			return &webidv1alpha1.ConfigMapReference{LocalObjectReference: corev1.LocalObjectReference{Name: name}, Optional: opt}
+		}
+
+		It("publishes a key of a ConfigMap as the page", func() {
+			data, info, err := source(&webidv1alpha1.ContentsSource{ConfigMapKeyRef: keyRef("site", "index.html", nil)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(data).To(Equal(PageData{"page.html": []byte("<h1>site</h1>")}))
+			Expect(info).To(HaveKey("page.html"))
+		})
+
+		It("publishes a key of a Secret as the page", func() {
+			data, _, err := source(&webidv1alpha1.ContentsSource{SecretKeyRef: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "private"}, Key: "page"}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(data).To(Equal(PageData{"page.html": []byte("secret")}))
+		})
+
+		It("publishes all keys of a ConfigMap", func() {
+			data, _, err := source(&webidv1alpha1.ContentsSource{ConfigMapRef: cmRef("site", nil)})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(data).To(HaveLen(2))
+			Expect(data).To(HaveKey("style.css"))
+		})
+
+		DescribeTable("missing references",
+			func(src *webidv1alpha1.ContentsSource, reason string) {
+				data, _, err := source(src)
+				if reason == "" {
+					Expect(err).NotTo(HaveOccurred())
+					Expect(data).To(BeEmpty())
+					return
+				}
+				Expect(isPageError(err)).To(BeTrue())
+				Expect(err.(*pageError).reason).To(Equal(reason))
+			},
+			Entry("missing ConfigMap", &webidv1alpha1.ContentsSource{ConfigMapKeyRef: keyRef("none", "x", nil)}, reasonReferenceNotFound),
+			Entry("missing key", &webidv1alpha1.ContentsSource{ConfigMapKeyRef: keyRef("site", "x", nil)}, reasonReferenceNotFound),
+			Entry("optional missing ConfigMap", &webidv1alpha1.ContentsSource{ConfigMapKeyRef: keyRef("none", "x", &optional)}, ""),
+			Entry("optional missing key", &webidv1alpha1.ContentsSource{ConfigMapKeyRef: keyRef("site", "x", &optional)}, ""),
+			Entry("missing whole ConfigMap", &webidv1alpha1.ContentsSource{ConfigMapRef: cmRef("none", nil)}, reasonReferenceNotFound),
+			Entry("optional missing whole ConfigMap", &webidv1alpha1.ContentsSource{ConfigMapRef: cmRef("none", &optional)}, ""),
+			Entry("no source", &webidv1alpha1.ContentsSource{}, reasonInvalidSpec),
+			Entry("two sources", &webidv1alpha1.ContentsSource{ConfigMapKeyRef: keyRef("site", "index.html", nil),
+				ConfigMapRef: cmRef("site", nil)}, reasonInvalidSpec),
+		)
+	})
+})
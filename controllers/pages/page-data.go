@@ -1,10 +1,97 @@
 package pages
 
-import "k8s.io/apimachinery/pkg/types"
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+)
+
+// ContentTypesAnnotation is set on ConfigMaps with stored pages (revisions, releases),
+// it holds JSON encoded content types of the files (see MarshalInfo)
+const ContentTypesAnnotation = "webid.golang.betsys.com/content-types"
 
 type DataProvider interface {
+	PrepareData(ctx context.Context, web *webidv1alpha1.WebServer) (*Prepared, error)
 	GetData(webNsName types.NamespacedName) map[string][]byte
+	GetInfo(webNsName types.NamespacedName) PageInfo
 	DataDiffer(oldData, newData map[string][]byte) bool
+	Forget(webNsName types.NamespacedName)
+}
+
+// Prepared is the result of DataProvider.PrepareData
+type Prepared struct {
+	// Changed is true if the data of the web server changed
+	Changed bool
+	// Hash is the hash of the published data (set if Changed)
+	Hash string
+	// Next is the time to the next publish/expire time of the pages, or to the next change of time-dependent
+	// template data, 0 if there is none
+	Next time.Duration
+	// Pages lists the pages ('namespace/name') of the web server
+	Pages []string
+}
+
+// FileInfo describes how a published file shall be served
+type FileInfo struct {
+	// ContentType is the explicit MIME type of the file, empty means nginx default
+	ContentType string
+	// CSP is the Content-Security-Policy of the page, empty means the WebServer one
+	CSP string `json:",omitempty"`
+	// ErrorCode is the HTTP status code the file is the error page for, 0 if none
+	ErrorCode int32 `json:",omitempty"`
+}
+
+// PageInfo holds FileInfo for each published file (by file name)
+type PageInfo map[string]FileInfo
+
+// Hash returns the hex encoded hash of the data and info
+func Hash(data map[string][]byte, info PageInfo) string {
+	return makeHash(log.Log, data, info)
+}
+
+// MarshalInfo encodes the info to be stored in ContentTypesAnnotation,
+// the info of a file is encoded as its content type, or as an object if it has other fields set
+func MarshalInfo(info PageInfo) (string, error) {
+	encoded := make(map[string]interface{}, len(info))
+	for name, i := range info {
+		if i.CSP == "" && i.ErrorCode == 0 {
+			encoded[name] = i.ContentType
+		} else {
+			encoded[name] = i
+		}
+	}
+	b, err := json.Marshal(encoded)
+	return string(b), err
+}
+
+// UnmarshalInfo decodes the info stored in ContentTypesAnnotation
+func UnmarshalInfo(s string) (PageInfo, error) {
+	encoded := make(map[string]json.RawMessage)
+	if err := json.Unmarshal([]byte(s), &encoded); err != nil {
+		return nil, err
+	}
+	info := make(PageInfo, len(encoded))
+	for name, raw := range encoded {
+		var i FileInfo
+		if err := json.Unmarshal(raw, &i.ContentType); err != nil {
+			if err = json.Unmarshal(raw, &i); err != nil {
+				return nil, err
+			}
+		}
+		info[name] = i
+	}
+	return info, nil
+}
+
+// PreviewKey returns the key of the preview data (drafts included) of the web server,
+// the '/' suffix can not collide with a name of another web server
+func PreviewKey(webNsName types.NamespacedName) types.NamespacedName {
+	return types.NamespacedName{Namespace: webNsName.Namespace, Name: webNsName.Name + "/preview"}
 }
 
 func (r *Reconciler) GetData(webNsName types.NamespacedName) map[string][]byte {
@@ -13,8 +100,25 @@ func (r *Reconciler) GetData(webNsName types.NamespacedName) map[string][]byte {
 	return r.Data[webNsName]
 }
 
-func (r *Reconciler) SetData(webNsName types.NamespacedName, data map[string][]byte) {
+func (r *Reconciler) GetInfo(webNsName types.NamespacedName) PageInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.Info[webNsName]
+}
+
+func (r *Reconciler) SetData(webNsName types.NamespacedName, data map[string][]byte, info PageInfo) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 	r.Data[webNsName] = data
+	r.Info[webNsName] = info
+}
+
+// Forget removes data of a deleted web server (including preview data)
+func (r *Reconciler) Forget(webNsName types.NamespacedName) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, key := range []types.NamespacedName{webNsName, PreviewKey(webNsName)} {
+		delete(r.Data, key)
+		delete(r.Info, key)
+	}
 }
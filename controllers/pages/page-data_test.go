@@ -0,0 +1,44 @@
+package pages
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("page info", func() {
+	It("stores files without other fields as content types", func() {
+		s, err := MarshalInfo(PageInfo{"index.html": {}, "logo.png": {ContentType: "image/png"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s).To(MatchJSON(`{"index.html": "", "logo.png": "image/png"}`))
+	})
+
+	It("round-trips all fields", func() {
+		info := PageInfo{
+			"index.html": {CSP: "default-src 'self'", ErrorCode: 0},
+			"404.html":   {ErrorCode: 404},
+			"logo.png":   {ContentType: "image/png"},
+		}
+		s, err := MarshalInfo(info)
+		Expect(err).NotTo(HaveOccurred())
+		decoded, err := UnmarshalInfo(s)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(decoded).To(Equal(info))
+	})
+
+	It("reads info stored by older versions", func() {
+		decoded, err := UnmarshalInfo(`{"index.html": "", "logo.png": "image/png"}`)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(decoded).To(Equal(PageInfo{"index.html": {}, "logo.png": {ContentType: "image/png"}}))
+	})
+
+	It("fails on invalid annotation", func() {
+		_, err := UnmarshalInfo(`["index.html"]`)
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("changes the hash when content type changes", func() {
+		data := map[string][]byte{"logo.png": {1}}
+		Expect(Hash(data, PageInfo{"logo.png": {ContentType: "image/png"}})).
+			NotTo(Equal(Hash(data, PageInfo{"logo.png": {ContentType: "image/gif"}})))
+	})
+})
@@ -4,22 +4,30 @@ import (
 	"bytes"
 	"context"
 	"crypto/sha1"
-	"encoding/base64"
+	"encoding/hex"
 	"io"
+	"reflect"
 	"sort"
+	"strconv"
 	"sync"
+	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	"github.com/go-logr/logr"
 	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+	"github.com/tomasji/webid-operator/controllers/config"
 	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
@@ -29,7 +37,9 @@ import (
 type Reconciler struct {
 	client.Client
 	Scheme *runtime.Scheme
+	Cfg    *config.Config
 	Data   map[types.NamespacedName]PageData
+	Info   map[types.NamespacedName]PageInfo
 	mu     sync.Mutex
 }
 
@@ -37,12 +47,21 @@ type PageData map[string][]byte
 
 const (
 	pageFinalizer = "tomasji.github.com/finalizer"
-	webServerKey  = "spec.webserver"
+	// WebServerKey is the page index key of the referenced WebServer ('namespace/name', see WebServerRef)
+	WebServerKey = "spec.webserver"
+
+	typeContentsResolved = "ContentsResolved"
+	typeWebServerMissing = "WebServerMissing"
 )
 
 //+kubebuilder:rbac:groups=webid.golang.betsys.com,resources=pages,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=webid.golang.betsys.com,resources=pages/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=webid.golang.betsys.com,resources=pages/finalizers,verbs=update
+//+kubebuilder:rbac:groups=core,resources=configmaps;secrets,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=create;delete
+//+kubebuilder:rbac:groups=webid.golang.betsys.com,resources=pagegrants,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=namespaces,verbs=get;list;watch
+//+kubebuilder:rbac:groups=webid.golang.betsys.com,resources=redirects,verbs=get;list;watch;create;update;delete;deletecollection
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -67,30 +86,64 @@ func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Resu
 		}
 	}
 
-	web, err := r.getWebServer(ctx, types.NamespacedName{Namespace: page.Namespace, Name: page.Spec.WebServer})
+	web, missing, err := r.pageWebServer(ctx, page)
 	if err != nil {
 		return ctrl.Result{}, err
 	}
-
-	// Get all pages for given webserver, prepare Data
-	dataChanged, hash, err := r.prepareData(ctx, page.Namespace, page.Spec.WebServer)
-	if err != nil {
-		log.Error(err, "Failed to get web page data", "webserver", page.Spec.WebServer)
+	if web == nil {
+		// the page waits for the webserver to be (re)created, it is reconciled again then (see SetupWithManager)
+		if markedForDeletion {
+			return ctrl.Result{}, r.removeFinalizer(ctx, page)
+		}
+		return ctrl.Result{}, r.setCondition(ctx, page, missing)
+	}
+	if !markedForDeletion {
+		if err = r.setCondition(ctx, page, missing); err != nil {
+			return ctrl.Result{}, err
+		}
+		// the page is not published, until the reference is granted (it is reconciled again then, see SetupWithManager)
+		if page.Spec.WebServer != "" {
+			granted, err := r.checkGrant(ctx, page)
+			if err != nil || !granted {
+				return ctrl.Result{}, err
+			}
+		}
 	}
 
-	// if data's changed, update the web server status and trigger its reconcile
-	if dataChanged {
-		if err = r.setWebStatus(ctx, web, hash); err != nil {
+	// Check the page contents can be resolved and rendered, report errors and the publishing schedule
+	now := time.Now()
+	if !markedForDeletion {
+		if err = r.checkContents(ctx, page, web); err != nil {
+			return ctrl.Result{}, err
+		}
+		if err = r.setCondition(ctx, page, scheduleCondition(page, now)); err != nil {
+			return ctrl.Result{}, err
+		}
+		if err = r.setPreviewURL(ctx, page, web); err != nil {
+			return ctrl.Result{}, err
+		}
+		if err = r.redirectRenamed(ctx, page, web); err != nil {
 			return ctrl.Result{}, err
 		}
 	}
 
+	// Data of the webserver are prepared by the WebServer controller, it watches the pages (see PrepareData)
 	if markedForDeletion {
+		if err = r.deleteRedirects(ctx, page, web); err != nil {
+			return ctrl.Result{}, err
+		}
 		if err = r.removeFinalizer(ctx, page); err != nil {
 			return ctrl.Result{}, err
 		}
+		debug("Reconcile: completed")
+		return ctrl.Result{}, nil
 	}
 
+	// requeue at the time the page gets published/expires
+	if next := nextTransition(page, now); next > 0 {
+		debug("Reconcile: completed, requeue at the next schedule transition", "after", next)
+		return ctrl.Result{RequeueAfter: next}, nil
+	}
 	debug("Reconcile: completed")
 	return ctrl.Result{}, nil
 }
@@ -148,7 +201,10 @@ func (r *Reconciler) removeFinalizer(ctx context.Context, page *webidv1alpha1.Pa
 	return nil
 }
 
-// getWebServer retrieves webserver object
+// getWebServer retrieves webserver object, it returns:
+// - nil, nil -> webserver not found
+// - nil, error -> stop reconciliation (requeue)
+// - web, nil -> got it
 func (r *Reconciler) getWebServer(ctx context.Context, namespacedName types.NamespacedName) (webserver *webidv1alpha1.WebServer, err error) {
 	log := log.FromContext(ctx)
 
@@ -156,53 +212,163 @@ func (r *Reconciler) getWebServer(ctx context.Context, namespacedName types.Name
 	if err = r.Get(ctx, namespacedName, webserver); err != nil {
 		if apierrors.IsNotFound(err) {
 			log.Info("WebServer resource for Page not found.", "namespace", namespacedName.Namespace, "name", namespacedName.Name)
-		} else {
-			log.Error(err, "Failed to get WebServer for Page.", "namespace", namespacedName.Namespace, "name", namespacedName.Name)
+			return nil, nil
 		}
+		log.Error(err, "Failed to get WebServer for Page.", "namespace", namespacedName.Namespace, "name", namespacedName.Name)
 		return nil, err
 	}
 	return webserver, nil
 }
 
-// prepareData gets list of Page objects that belong to the given webServer and
-// prepares a map of data - if it is different from what is stored in r.Data, update it and return changed=true
-func (r *Reconciler) prepareData(ctx context.Context, namespace, webServer string) (changed bool, sha string, err error) {
+// listPages returns Page objects that belong to the given webServer - referencing it or selected by its
+// spec.pageSelector, pages from other namespaces referencing it are returned only if a PageGrant allows them
+func (r *Reconciler) listPages(ctx context.Context, web *webidv1alpha1.WebServer) ([]webidv1alpha1.Page, error) {
+	nsName := types.NamespacedName{Namespace: web.Namespace, Name: web.Name}
+	list := &webidv1alpha1.PageList{}
+	if err := r.List(ctx, list, client.MatchingFields{WebServerKey: nsName.String()}); err != nil {
+		return nil, err
+	}
+
+	g, err := r.grantsOf(ctx, nsName)
+	if err != nil {
+		return nil, err
+	}
+	pages := make([]webidv1alpha1.Page, 0, len(list.Items))
+	seen := make(map[string]bool)
+	for i := range list.Items {
+		allowed, err := g.allows(ctx, nsName, &list.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		if allowed {
+			pages = append(pages, list.Items[i])
+			seen[pageKey(&list.Items[i])] = true
+		}
+	}
+
+	selected, err := r.selectedPages(ctx, web)
+	if err != nil {
+		return nil, err
+	}
+	for i := range selected {
+		if !seen[pageKey(&selected[i])] {
+			pages = append(pages, selected[i])
+		}
+	}
+	return pages, nil
+}
+
+// PrepareData gets list of Page objects that belong to the given webServer and
+// prepares a map of data - if it is different from what is stored in r.Data, update it and return Changed=true.
+// If the preview is enabled, the preview data (drafts included) are prepared as well.
+func (r *Reconciler) PrepareData(ctx context.Context, web *webidv1alpha1.WebServer) (*Prepared, error) {
 	log := log.FromContext(ctx)
 	debug := log.V(1).Info
 
-	nsName := types.NamespacedName{Namespace: namespace, Name: webServer}
+	nsName := types.NamespacedName{Namespace: web.Namespace, Name: web.Name}
 
 	// Get list of pages for given webserver
-	list := &webidv1alpha1.PageList{}
-	opts := []client.ListOption{
-		client.InNamespace(namespace),
-		client.MatchingFields{webServerKey: webServer},
+	pages, err := r.listPages(ctx, web)
+	if err != nil {
+		return nil, err
 	}
-	err = r.List(ctx, list, opts...)
+	res := &Prepared{Pages: make([]string, 0, len(pages))}
+	now := time.Now()
+	for i := range pages {
+		for _, t := range []time.Duration{nextTransition(&pages[i], now), nextRender(&pages[i], now)} {
+			if t > 0 && (res.Next == 0 || t < res.Next) {
+				res.Next = t
+			}
+		}
+		if pages[i].GetDeletionTimestamp() == nil {
+			res.Pages = append(res.Pages, pageKey(&pages[i]))
+		}
+	}
+	sort.Strings(res.Pages)
+
+	newData, newInfo, err := r.collectData(ctx, web, pages, now, false)
 	if err != nil {
-		return false, "", err
+		return nil, err
+	}
+	var previewData PageData
+	var previewInfo PageInfo
+	if web.Spec.Preview != nil {
+		if previewData, previewInfo, err = r.collectData(ctx, web, pages, now, true); err != nil {
+			return nil, err
+		}
+	}
+
+	res.Changed = r.storeData(nsName, newData, newInfo)
+	res.Changed = r.storeData(PreviewKey(nsName), previewData, previewInfo) || res.Changed
+	if res.Changed {
+		debug("Page data changed, updating")
+		res.Hash = makeHash(log, newData, newInfo)
 	}
-	newData := make(map[string][]byte)
-	for _, i := range list.Items {
+	return res, nil
+}
+
+// collectData returns the files of all pages published at the given time, drafts are included in preview only
+func (r *Reconciler) collectData(ctx context.Context, web *webidv1alpha1.WebServer, pages []webidv1alpha1.Page,
+	now time.Time, preview bool,
+) (PageData, PageInfo, error) {
+	debug := log.FromContext(ctx).V(1).Info
+
+	td := newTemplateData(web, pages, now, preview)
+	san := newSanitizer(web)
+	newData := make(PageData)
+	newInfo := make(PageInfo)
+	for _, i := range pages {
 		if i.GetDeletionTimestamp() != nil { // marked for deletion
 			debug("Deleting Page", "name", i.Spec.Name)
 			continue
 		}
-		debug("Got Page", "name", i.Spec.Name)
-		newData[i.Spec.Name] = []byte(i.Spec.Contents)
+		if !isPublished(&i, now) {
+			debug("Skipping Page that is not published (scheduled or expired)", "name", i.Spec.Name)
+			continue
+		}
+		if i.Spec.Draft && !preview {
+			debug("Skipping draft Page", "name", i.Spec.Name)
+			continue
+		}
+		files, info, err := r.pageFiles(ctx, &i, td)
+		if err != nil {
+			if !isPageError(err) {
+				return nil, nil, err
+			}
+			debug("Skipping Page that can not be published", "name", i.Spec.Name, "reason", err.Error())
+			continue
+		}
+		if files, _, _, err = san.sanitizeFiles(files, info); err != nil {
+			if !isPageError(err) {
+				return nil, nil, err
+			}
+			debug("Skipping Page that can not be sanitized", "name", i.Spec.Name, "reason", err.Error())
+			continue
+		}
+		debug("Got Page", "name", i.Spec.Name, "preview", preview)
+		for name, contents := range files {
+			newData[name] = contents
+			fileInfo := info[name]
+			fileInfo.CSP = i.Spec.ContentSecurityPolicy
+			if name == i.Spec.Name {
+				fileInfo.ErrorCode = i.Spec.ErrorCode
+			}
+			newInfo[name] = fileInfo
+		}
 	}
-	oldData := r.GetData(nsName)
+	return newData, newInfo, nil
+}
 
-	if r.DataDiffer(oldData, newData) {
-		debug("Page data changed, updating")
-		r.SetData(nsName, newData)
-		hash := makeHash(log, newData)
-		return true, hash, nil
+// storeData stores the data if they differ from the stored ones, returns true if they were changed
+func (r *Reconciler) storeData(nsName types.NamespacedName, data PageData, info PageInfo) bool {
+	if !r.DataDiffer(r.GetData(nsName), data) && reflect.DeepEqual(r.GetInfo(nsName), info) {
+		return false
 	}
-	return false, "", nil
+	r.SetData(nsName, data, info)
+	return true
 }
 
-func makeHash(log logr.Logger, data map[string][]byte) string {
+func makeHash(log logr.Logger, data map[string][]byte, info PageInfo) string {
 	h := sha1.New()
 	keys := make([]string, 0, len(data))
 	for k := range data {
@@ -215,8 +381,13 @@ func makeHash(log logr.Logger, data map[string][]byte) string {
 		if _, err := io.Copy(h, buf); err != nil {
 			log.Error(err, "writing sha1")
 		}
+		io.WriteString(h, info[k].ContentType)
+		io.WriteString(h, info[k].CSP)
+		if code := info[k].ErrorCode; code != 0 {
+			io.WriteString(h, strconv.Itoa(int(code)))
+		}
 	}
-	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+	return hex.EncodeToString(h.Sum(nil))
 }
 
 // DataDiffer compares 2 maps and returns true if they differ
@@ -242,43 +413,149 @@ func (r *Reconciler) DataDiffer(oldData, newData map[string][]byte) bool {
 	return false
 }
 
-// setWebStatus updates status conditions of the webserver object
-func (r *Reconciler) setWebStatus(ctx context.Context, web *webidv1alpha1.WebServer, hash string) (err error) {
-	const statusReason = "Reconciling"
+// checkContents resolves, renders and sanitizes the page contents and sets the ContentsResolved condition accordingly
+func (r *Reconciler) checkContents(ctx context.Context, page *webidv1alpha1.Page, web *webidv1alpha1.WebServer) error {
+	// the other pages are needed only to render templates
+	var pages []webidv1alpha1.Page
+	if page.Spec.Template {
+		var err error
+		if pages, err = r.listPages(ctx, web); err != nil {
+			return err
+		}
+	}
+
+	condition := metav1.Condition{Type: typeContentsResolved, Status: metav1.ConditionTrue,
+		Reason: "Resolved", Message: "Page contents resolved"}
+	source, info, err := r.sourceFiles(ctx, page)
+	files := source
+	if err == nil && page.Spec.Template {
+		files, err = newTemplateData(web, pages, time.Now(), page.Spec.Draft).renderFiles(page, source)
+	}
+	var elements, attributes []string
+	if err == nil {
+		_, elements, attributes, err = newSanitizer(web).sanitizeFiles(files, info)
+	}
+	if err != nil {
+		if !isPageError(err) {
+			return err
+		}
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = err.(*pageError).reason
+		condition.Message = err.Error()
+	}
+	if err = r.setCondition(ctx, page, condition); err != nil || condition.Status != metav1.ConditionTrue {
+		return err
+	}
+
+	// keep the source contents in the revision history, templates are rendered (and all files sanitized)
+	// when published, so that changes of other pages listed by a template do not create new revisions
+	if err = r.recordRevision(ctx, page, source, info); err != nil {
+		return err
+	}
+	return r.setStripped(ctx, page, elements, attributes)
+}
+
+// setStripped reports the elements and attributes stripped from the page by the sanitizer in the page status
+func (r *Reconciler) setStripped(ctx context.Context, page *webidv1alpha1.Page, elements, attributes []string) error {
+	if reflect.DeepEqual(page.Status.StrippedElements, elements) && reflect.DeepEqual(page.Status.StrippedAttributes, attributes) {
+		return nil
+	}
+
+	page.Status.StrippedElements = elements
+	page.Status.StrippedAttributes = attributes
+	if err := r.Status().Update(ctx, page); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to update Page status")
+		return err
+	}
+	return nil
+}
+
+// setPreviewURL reports the URL of the page on the preview host (if the preview is enabled) in the page status
+func (r *Reconciler) setPreviewURL(ctx context.Context, page *webidv1alpha1.Page, web *webidv1alpha1.WebServer) error {
+	url := ""
+	if web.Spec.Preview != nil {
+		url = "http://" + r.Cfg.PreviewHost(web) + PathPrefix(web) + page.Spec.Name
+	}
+	if page.Status.PreviewURL == url {
+		return nil
+	}
+
+	page.Status.PreviewURL = url
+	if err := r.Status().Update(ctx, page); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to update Page status")
+		return err
+	}
+	return nil
+}
+
+// setCondition sets the status condition of the page, the status is updated only if the condition changes
+func (r *Reconciler) setCondition(ctx context.Context, page *webidv1alpha1.Page, condition metav1.Condition) error {
 	log := log.FromContext(ctx)
-	debug := log.V(1).Info
 
-	debug("Setting webserver status", "namespace", web.Namespace, "name", web.Name, "hash", hash)
-	meta.SetStatusCondition(&web.Status.Conditions, metav1.Condition{
-		Type:   "UpToDate",
-		Status: metav1.ConditionFalse,
-		Reason: "PageChanged", Message: "Reconciling",
-	})
-	if web.ObjectMeta.Annotations == nil {
-		web.ObjectMeta.Annotations = make(map[string]string)
-	}
-	web.ObjectMeta.Annotations["pages"] = hash
-	if err = r.Update(ctx, web); err != nil {
-		log.Error(err, "Failed to update WebServer status")
+	condition.ObservedGeneration = page.Generation
+	old := meta.FindStatusCondition(page.Status.Conditions, condition.Type)
+	if old != nil && old.Status == condition.Status && old.Reason == condition.Reason &&
+		old.Message == condition.Message && old.ObservedGeneration == condition.ObservedGeneration {
+		return nil
+	}
+
+	meta.SetStatusCondition(&page.Status.Conditions, condition)
+	if err := r.Status().Update(ctx, page); err != nil {
+		log.Error(err, "Failed to update Page status")
 		return err
 	}
 	return nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
-// Create a new index "spec.webserver" in the cache, so that we can filter by it
+// Create a new index "spec.webserver" in the cache, so that we can filter by it,
+// and indexes of ConfigMaps/Secrets referenced by pages, so that pages are republished when they change,
+// WebServers are indexed by the namespaces selected by their spec.pageSelector (see SelectingWebServers).
+// Pages are also re-rendered when spec of their WebServer changes (template variables),
+// and reconciled when their WebServer is created or deleted (WebServerMissing condition).
+// Pages are reconciled when PageGrants change (ReferenceGranted condition, selection by WebServers from other namespaces).
 func (r *Reconciler) SetupWithManager(mgr ctrl.Manager) error {
-	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &webidv1alpha1.Page{}, webServerKey,
+
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &webidv1alpha1.Page{}, WebServerKey,
+		func(rawObj client.Object) []string {
+			page := rawObj.(*webidv1alpha1.Page)
+			if page.Spec.WebServer == "" {
+				return nil
+			}
+			return []string{WebServerRef(page).String()}
+		}); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &webidv1alpha1.Page{}, webServerNamespaceKey,
 		func(rawObj client.Object) []string {
 			page := rawObj.(*webidv1alpha1.Page)
-			return []string{page.Spec.WebServer}
+			if page.Spec.WebServer == "" {
+				return nil
+			}
+			return []string{WebServerRef(page).Namespace}
 		}); err != nil {
 		return err
 	}
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &webidv1alpha1.WebServer{}, PageSelectorKey,
+		selectedNamespaces); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &webidv1alpha1.Page{}, ConfigMapKey,
+		referencedConfigMaps); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &webidv1alpha1.Page{}, SecretKey,
+		referencedSecrets); err != nil {
+		return err
+	}
 
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&webidv1alpha1.Page{}).
-		WithEventFilter(pageEventFilter()).
+		For(&webidv1alpha1.Page{}, builder.WithPredicates(pageEventFilter())).
+		Watches(&source.Kind{Type: &corev1.ConfigMap{}}, handler.EnqueueRequestsFromMapFunc(r.pagesReferencing(ConfigMapKey))).
+		Watches(&source.Kind{Type: &corev1.Secret{}}, handler.EnqueueRequestsFromMapFunc(r.pagesReferencing(SecretKey))).
+		Watches(&source.Kind{Type: &webidv1alpha1.WebServer{}}, handler.EnqueueRequestsFromMapFunc(r.pagesOfWebServer),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&source.Kind{Type: &webidv1alpha1.PageGrant{}}, handler.EnqueueRequestsFromMapFunc(r.pagesOfGrant)).
 		Complete(r)
 }
 
@@ -0,0 +1,118 @@
+package pages
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+)
+
+// redirectPageLabel is set on the Redirects created for renamed pages, value is pageHash of the Page
+// (its name may be longer than a label value)
+const redirectPageLabel = "webid.golang.betsys.com/page"
+
+// maxNameLength is the maximum length of an object name (DNS subdomain)
+const maxNameLength = 253
+
+// pageHash returns the hash of the namespace and the name of the page
+func pageHash(page *webidv1alpha1.Page) string {
+	h := sha1.Sum([]byte(page.Namespace + "/" + page.Name))
+	return hex.EncodeToString(h[:])
+}
+
+// redirectName returns the name of the Redirect from the old name of the page: the page name (truncated
+// to fit the name length) and a hash of the page and the old name
+func redirectName(page *webidv1alpha1.Page, old string) string {
+	suffix := "-" + shortHash(page.Namespace+"/"+page.Name+"/"+old)
+	name := page.Name
+	if len(name) > maxNameLength-len(suffix) {
+		name = strings.TrimRight(name[:maxNameLength-len(suffix)], ".-")
+	}
+	return name + suffix
+}
+
+// autoRedirects lists the Redirects created for the renamed page (in the namespace of the web server)
+func (r *Reconciler) autoRedirects(ctx context.Context, page *webidv1alpha1.Page, web *webidv1alpha1.WebServer) ([]webidv1alpha1.Redirect, error) {
+	list := &webidv1alpha1.RedirectList{}
+	err := r.List(ctx, list, client.InNamespace(web.Namespace), client.MatchingLabels{redirectPageLabel: pageHash(page)})
+	return list.Items, err
+}
+
+// redirectRenamed keeps the Redirects of the renamed page pointing to its current name (see spec.autoRedirect):
+// it creates one from the last published name, retargets the older ones and deletes the one from the current
+// name (the page was renamed back). The current name is recorded in status.publishedName.
+func (r *Reconciler) redirectRenamed(ctx context.Context, page *webidv1alpha1.Page, web *webidv1alpha1.WebServer) error {
+	log := log.FromContext(ctx)
+	name, old := page.Spec.Name, page.Status.PublishedName
+
+	if web.Spec.AutoRedirect {
+		redirects, err := r.autoRedirects(ctx, page, web)
+		if err != nil {
+			return err
+		}
+		exists := false
+		for i := range redirects {
+			redirect := &redirects[i]
+			switch {
+			case redirect.Spec.From == name:
+				log.Info("Deleting Redirect of the page renamed back", "namespace", redirect.Namespace, "name", redirect.Name)
+				if err = r.Delete(ctx, redirect); err != nil && !apierrors.IsNotFound(err) {
+					return err
+				}
+				continue
+			case redirect.Spec.To != name || redirect.Spec.WebServer != web.Name:
+				redirect.Spec.To = name
+				redirect.Spec.WebServer = web.Name
+				if err = r.Update(ctx, redirect); err != nil {
+					return err
+				}
+			}
+			exists = exists || redirect.Spec.From == old
+		}
+
+		if old != "" && old != name && !exists {
+			redirect := &webidv1alpha1.Redirect{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      redirectName(page, old),
+					Namespace: web.Namespace,
+					Labels:    map[string]string{redirectPageLabel: pageHash(page)},
+				},
+				Spec: webidv1alpha1.RedirectSpec{WebServer: web.Name, From: old, To: name, StatusCode: 301},
+			}
+			log.Info("Creating Redirect of the renamed page", "namespace", redirect.Namespace, "name", redirect.Name,
+				"from", old, "to", name)
+			if err = r.Create(ctx, redirect); err != nil && !apierrors.IsAlreadyExists(err) {
+				return err
+			}
+		}
+	}
+
+	if old == name {
+		return nil
+	}
+	page.Status.PublishedName = name
+	if err := r.Status().Update(ctx, page); err != nil {
+		log.Error(err, "Failed to update Page status")
+		return err
+	}
+	return nil
+}
+
+// deleteRedirects deletes the Redirects created for the deleted page
+func (r *Reconciler) deleteRedirects(ctx context.Context, page *webidv1alpha1.Page, web *webidv1alpha1.WebServer) error {
+	return r.DeleteAllOf(ctx, &webidv1alpha1.Redirect{}, client.InNamespace(web.Namespace),
+		client.MatchingLabels{redirectPageLabel: pageHash(page)})
+}
+
+// shortHash returns a short hex encoded hash of the string, usable in object names
+func shortHash(s string) string {
+	h := sha1.Sum([]byte(s))
+	return hex.EncodeToString(h[:])[:10]
+}
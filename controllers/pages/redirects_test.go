@@ -0,0 +1,88 @@
+package pages
+
+import (
+	"context"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+)
+
+var _ = Describe("Redirects of renamed pages", func() {
+	ctx := context.Background()
+	web := &webidv1alpha1.WebServer{ObjectMeta: metav1.ObjectMeta{Namespace: "docs", Name: "public"},
+		Spec: webidv1alpha1.WebServerSpec{AutoRedirect: true}}
+	// a page name of the maximum length, it ends with a dot when truncated for the Redirect name
+	longName := strings.Repeat("a", 241) + ".b" + strings.Repeat("c", 10)
+
+	renamed := func(namespace, name string) *webidv1alpha1.Page {
+		return &webidv1alpha1.Page{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+			Spec:   webidv1alpha1.PageSpec{Name: "new.html"},
+			Status: webidv1alpha1.PageStatus{PublishedName: "old.html"}}
+	}
+	newReconciler := func(objs ...client.Object) *Reconciler {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(webidv1alpha1.AddToScheme(scheme)).To(Succeed())
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(append(objs, web)...).Build()
+		return &Reconciler{Client: c, Scheme: scheme}
+	}
+	redirects := func(r *Reconciler) []webidv1alpha1.Redirect {
+		list := &webidv1alpha1.RedirectList{}
+		Expect(r.List(ctx, list, client.InNamespace("docs"))).To(Succeed())
+		return list.Items
+	}
+
+	It("creates a valid Redirect for a page with a long name", func() {
+		Expect(longName).To(HaveLen(maxNameLength))
+		page := renamed("team", longName)
+		r := newReconciler(page)
+		Expect(r.redirectRenamed(ctx, page, web)).To(Succeed())
+
+		items := redirects(r)
+		Expect(items).To(HaveLen(1))
+		Expect(validation.IsDNS1123Subdomain(items[0].Name)).To(BeEmpty())
+		for _, value := range items[0].Labels {
+			Expect(validation.IsValidLabelValue(value)).To(BeEmpty())
+		}
+		Expect(items[0].Spec.From).To(Equal("old.html"))
+		Expect(items[0].Spec.To).To(Equal("new.html"))
+		Expect(page.Status.PublishedName).To(Equal("new.html"))
+	})
+
+	It("keeps the Redirects of same named pages from different namespaces apart", func() {
+		page, other := renamed("team", "index"), renamed("other", "index")
+		r := newReconciler(page, other)
+		Expect(r.redirectRenamed(ctx, page, web)).To(Succeed())
+		Expect(r.redirectRenamed(ctx, other, web)).To(Succeed())
+		Expect(redirects(r)).To(HaveLen(2))
+
+		Expect(r.deleteRedirects(ctx, page, web)).To(Succeed())
+		items := redirects(r)
+		Expect(items).To(HaveLen(1))
+		Expect(items[0].Labels[redirectPageLabel]).To(Equal(pageHash(other)))
+	})
+
+	It("replaces the Redirect when the page is renamed back", func() {
+		page := renamed("team", longName)
+		r := newReconciler(page)
+		Expect(r.redirectRenamed(ctx, page, web)).To(Succeed())
+		Expect(redirects(r)).To(HaveLen(1))
+
+		page.Spec.Name = "old.html"
+		Expect(r.redirectRenamed(ctx, page, web)).To(Succeed())
+		items := redirects(r)
+		Expect(items).To(HaveLen(1))
+		Expect(items[0].Spec.From).To(Equal("new.html"))
+		Expect(items[0].Spec.To).To(Equal("old.html"))
+	})
+})
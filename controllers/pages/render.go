@@ -0,0 +1,110 @@
+package pages
+
+import (
+	"bytes"
+	"html/template"
+	"sort"
+	"time"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+)
+
+// templateData is the data context of page templates (see PageSpec.Template)
+type templateData struct {
+	// prefix is the path prefix of the web server (see WebServerSpec.PathPrefix)
+	prefix    string
+	WebServer templateWebServer
+	Page      templatePage
+	Pages     []templatePage
+	Variables map[string]string
+	Year      int
+}
+
+// templateWebServer holds WebServer metadata available to templates
+type templateWebServer struct {
+	Name       string
+	Namespace  string
+	Labels     map[string]string
+	PathPrefix string
+}
+
+// templatePage holds page metadata available to templates
+type templatePage struct {
+	Name  string
+	Path  string
+	Title string
+}
+
+// newTemplateData creates data context for templates of the pages of the web server,
+// only pages published at the given time are listed, drafts are listed in preview only
+func newTemplateData(web *webidv1alpha1.WebServer, pages []webidv1alpha1.Page, now time.Time, preview bool) *templateData {
+	td := &templateData{
+		prefix: PathPrefix(web),
+		WebServer: templateWebServer{Name: web.Name, Namespace: web.Namespace, Labels: web.Labels,
+			PathPrefix: PathPrefix(web)},
+		Variables: web.Spec.Variables,
+		Year:      now.Year(),
+	}
+	for i := range pages {
+		if pages[i].GetDeletionTimestamp() != nil || !isPublished(&pages[i], now) || (pages[i].Spec.Draft && !preview) {
+			continue
+		}
+		td.Pages = append(td.Pages, td.pageRef(&pages[i]))
+	}
+	sort.Slice(td.Pages, func(i, j int) bool { return td.Pages[i].Name < td.Pages[j].Name })
+	return td
+}
+
+// pageRef returns metadata of the page for templates, the path includes the path prefix of the web server
+func (td *templateData) pageRef(page *webidv1alpha1.Page) templatePage {
+	title := page.Spec.Title
+	if title == "" {
+		title = page.Spec.Name
+	}
+	return templatePage{Name: page.Spec.Name, Path: td.prefix + page.Spec.Name, Title: title}
+}
+
+// nextRender returns the duration to the next change of the time-dependent template data (.Year),
+// 0 if the page is not a template
+func nextRender(page *webidv1alpha1.Page, now time.Time) time.Duration {
+	if !page.Spec.Template {
+		return 0
+	}
+	return time.Date(now.Year()+1, time.January, 1, 0, 0, 0, 0, now.Location()).Sub(now)
+}
+
+// PathPrefix returns spec.pathPrefix of the web server, '/' if not set
+func PathPrefix(web *webidv1alpha1.WebServer) string {
+	if web.Spec.PathPrefix == "" {
+		return "/"
+	}
+	return web.Spec.PathPrefix
+}
+
+// renderFiles renders all the files of the page, the source files are not modified
+func (td *templateData) renderFiles(page *webidv1alpha1.Page, files PageData) (PageData, error) {
+	rendered := make(PageData, len(files))
+	for name, contents := range files {
+		var err error
+		if rendered[name], err = td.render(page, contents); err != nil {
+			return nil, err
+		}
+	}
+	return rendered, nil
+}
+
+// render renders the contents of the page as html/template, errors are returned as pageError
+func (td *templateData) render(page *webidv1alpha1.Page, contents []byte) ([]byte, error) {
+	tmpl, err := template.New(page.Spec.Name).Option("missingkey=error").Parse(string(contents))
+	if err != nil {
+		return nil, &pageError{reason: reasonTemplateError, msg: err.Error()}
+	}
+
+	data := *td
+	data.Page = td.pageRef(page)
+	buf := &bytes.Buffer{}
+	if err = tmpl.Execute(buf, data); err != nil {
+		return nil, &pageError{reason: reasonTemplateError, msg: err.Error()}
+	}
+	return buf.Bytes(), nil
+}
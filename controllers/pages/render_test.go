@@ -0,0 +1,76 @@
+package pages
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+)
+
+var _ = Describe("render", func() {
+	now := time.Date(2024, time.June, 15, 12, 0, 0, 0, time.UTC)
+	web := &webidv1alpha1.WebServer{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web"},
+		Spec:       webidv1alpha1.WebServerSpec{PathPrefix: "/docs/", Variables: map[string]string{"company": "ACME"}},
+	}
+	page := func(name, title string, template bool) webidv1alpha1.Page {
+		return webidv1alpha1.Page{Spec: webidv1alpha1.PageSpec{Name: name, Title: title, Template: template}}
+	}
+
+	It("lists published pages sorted by name with prefixed paths", func() {
+		draft := page("draft.html", "", false)
+		draft.Spec.Draft = true
+		scheduled := page("later.html", "", false)
+		scheduled.Spec.PublishAt = &metav1.Time{Time: now.Add(time.Hour)}
+		pages := []webidv1alpha1.Page{page("b.html", "B", false), page("a.html", "", false), draft, scheduled}
+
+		td := newTemplateData(web, pages, now, false)
+		Expect(td.Pages).To(Equal([]templatePage{
+			{Name: "a.html", Path: "/docs/a.html", Title: "a.html"},
+			{Name: "b.html", Path: "/docs/b.html", Title: "B"},
+		}))
+		Expect(newTemplateData(web, pages, now, true).Pages).To(HaveLen(3))
+	})
+
+	It("renders the data context", func() {
+		p := page("index.html", "Home", true)
+		td := newTemplateData(web, []webidv1alpha1.Page{p}, now, false)
+		out, err := td.render(&p, []byte(`{{ .Page.Title }} {{ .Page.Path }} {{ .Variables.company }} {{ .Year }} {{ .WebServer.PathPrefix }}`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(out)).To(Equal("Home /docs/index.html ACME 2024 /docs/"))
+	})
+
+	It("escapes HTML", func() {
+		p := page("index.html", "<b>", true)
+		out, err := newTemplateData(web, nil, now, false).render(&p, []byte(`<p>{{ .Page.Title }}</p>`))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(out)).To(Equal("<p>&lt;b&gt;</p>"))
+	})
+
+	DescribeTable("template errors",
+		func(contents string) {
+			p := page("index.html", "", true)
+			_, err := newTemplateData(web, nil, now, false).render(&p, []byte(contents))
+			Expect(isPageError(err)).To(BeTrue())
+			Expect(err.(*pageError).reason).To(Equal(reasonTemplateError))
+		},
+		Entry("parse error", `{{ .Page.Title `),
+		Entry("missing variable", `{{ .Variables.missing }}`),
+		Entry("unknown field", `{{ .Nope }}`),
+	)
+
+	It("schedules the re-render of templates at the new year", func() {
+		Expect(nextRender(&webidv1alpha1.Page{}, now)).To(BeZero())
+		tmpl := page("index.html", "", true)
+		Expect(now.Add(nextRender(&tmpl, now))).To(Equal(time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)))
+	})
+
+	It("defaults path prefix to /", func() {
+		Expect(PathPrefix(&webidv1alpha1.WebServer{})).To(Equal("/"))
+		Expect(PathPrefix(web)).To(Equal("/docs/"))
+	})
+})
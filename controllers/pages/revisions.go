@@ -0,0 +1,180 @@
+package pages
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"reflect"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+)
+
+const (
+	// revisionPageLabel is set on revision ConfigMaps, value is the name of the Page object
+	revisionPageLabel = "webid.golang.betsys.com/page"
+	// revisionLabel is set on revision ConfigMaps, value is the revision name
+	revisionLabel = "webid.golang.betsys.com/revision"
+
+	defaultRevisionHistoryLimit = 10
+)
+
+// revisionName returns the name of the revision of the files - a hash of the contents
+func revisionName(files PageData, info PageInfo) string {
+	return Hash(files, info)[:10]
+}
+
+// revisionCMName returns the name of the ConfigMap storing the revision of the page
+func revisionCMName(page *webidv1alpha1.Page, revision string) string {
+	return page.Name + "-rev-" + revision
+}
+
+// recordRevision stores the source files of the page as a revision (gzipped ConfigMap owned by the page),
+// prunes revisions over spec.revisionHistoryLimit and reports the revisions in the page status
+func (r *Reconciler) recordRevision(ctx context.Context, page *webidv1alpha1.Page, files PageData, info PageInfo) error {
+	log := log.FromContext(ctx)
+
+	limit := defaultRevisionHistoryLimit
+	if page.Spec.RevisionHistoryLimit != nil {
+		limit = int(*page.Spec.RevisionHistoryLimit)
+	}
+
+	current := revisionName(files, info)
+	if err := r.createRevision(ctx, page, current, files, info); err != nil {
+		return err
+	}
+
+	list := &corev1.ConfigMapList{}
+	if err := r.List(ctx, list, client.InNamespace(page.Namespace), client.MatchingLabels{revisionPageLabel: page.Name}); err != nil {
+		return err
+	}
+	sort.Slice(list.Items, func(i, j int) bool {
+		ti, tj := list.Items[i].CreationTimestamp, list.Items[j].CreationTimestamp
+		if ti.Equal(&tj) {
+			return list.Items[i].Name > list.Items[j].Name
+		}
+		return tj.Before(&ti)
+	})
+
+	// the current and the rolled back revisions are kept always, the other ones up to the limit
+	revisions := []webidv1alpha1.PageRevision{}
+	for i := range list.Items {
+		cm := &list.Items[i]
+		name := cm.Labels[revisionLabel]
+		if len(revisions) < limit || name == current || name == page.Spec.Revision {
+			revisions = append(revisions, webidv1alpha1.PageRevision{Name: name, Created: cm.CreationTimestamp})
+			continue
+		}
+		log.Info("Deleting old revision of Page", "page", page.Name, "revision", name)
+		if err := r.Delete(ctx, cm); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	if page.Status.Revision == current && reflect.DeepEqual(page.Status.Revisions, revisions) {
+		return nil
+	}
+	page.Status.Revision = current
+	page.Status.Revisions = revisions
+	if err := r.Status().Update(ctx, page); err != nil {
+		log.Error(err, "Failed to update Page status")
+		return err
+	}
+	return nil
+}
+
+// createRevision creates the ConfigMap with the revision, if it does not exist yet
+func (r *Reconciler) createRevision(ctx context.Context, page *webidv1alpha1.Page, revision string,
+	files PageData, info PageInfo,
+) error {
+	data := make(map[string][]byte, len(files))
+	for name, contents := range files {
+		compressed, err := compress(contents)
+		if err != nil {
+			return err
+		}
+		data[name] = compressed
+	}
+	types, err := MarshalInfo(info)
+	if err != nil {
+		return err
+	}
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        revisionCMName(page, revision),
+			Namespace:   page.Namespace,
+			Labels:      map[string]string{revisionPageLabel: page.Name, revisionLabel: revision},
+			Annotations: map[string]string{ContentTypesAnnotation: types},
+		},
+		Immutable:  ptr(true),
+		BinaryData: data,
+	}
+	if err = ctrl.SetControllerReference(page, cm, r.Scheme); err != nil {
+		return err
+	}
+	if err = r.Create(ctx, cm); err != nil {
+		if apierrors.IsAlreadyExists(err) {
+			return nil
+		}
+		return err
+	}
+	log.FromContext(ctx).Info("Stored revision of Page", "page", page.Name, "revision", revision)
+	return nil
+}
+
+// revisionFiles returns the files stored in the revision of the page, pageError if the revision does not exist
+func (r *Reconciler) revisionFiles(ctx context.Context, page *webidv1alpha1.Page, revision string) (PageData, PageInfo, error) {
+	cm := &corev1.ConfigMap{}
+	if err := r.getRef(ctx, page.Namespace, revisionCMName(page, revision), cm); err != nil {
+		if isMissingRef(err) {
+			return nil, nil, missingRef("revision %q not found", revision)
+		}
+		return nil, nil, err
+	}
+
+	info, err := UnmarshalInfo(cm.Annotations[ContentTypesAnnotation])
+	if err != nil {
+		return nil, nil, err
+	}
+	data := make(PageData, len(cm.BinaryData))
+	for name, compressed := range cm.BinaryData {
+		contents, err := decompress(compressed)
+		if err != nil {
+			return nil, nil, err
+		}
+		data[name] = contents
+	}
+	return data, info, nil
+}
+
+func compress(data []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	w := gzip.NewWriter(buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decompress(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+func ptr[T any](v T) *T { return &v }
@@ -0,0 +1,76 @@
+package pages
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+)
+
+var _ = Describe("revisions", func() {
+	ctx := context.Background()
+	now := time.Date(2024, time.June, 15, 12, 0, 0, 0, time.UTC)
+	web := &webidv1alpha1.WebServer{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web"}}
+	var r *Reconciler
+	var page *webidv1alpha1.Page
+
+	BeforeEach(func() {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(webidv1alpha1.AddToScheme(scheme)).To(Succeed())
+		page = &webidv1alpha1.Page{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "index", UID: "uid"},
+			Spec: webidv1alpha1.PageSpec{Name: "index.html", Template: true,
+				Contents: `{{ range .Pages }}{{ .Name }} {{ end }}`},
+		}
+		r = &Reconciler{Client: fake.NewClientBuilder().WithScheme(scheme).WithObjects(page).Build(), Scheme: scheme}
+	})
+
+	revisionCMs := func() []corev1.ConfigMap {
+		list := &corev1.ConfigMapList{}
+		Expect(r.List(ctx, list, client.MatchingLabels{revisionPageLabel: page.Name})).To(Succeed())
+		return list.Items
+	}
+
+	It("stores the template source, other pages do not create revisions", func() {
+		for _, siblings := range [][]webidv1alpha1.Page{nil, {{Spec: webidv1alpha1.PageSpec{Name: "about.html"}}}} {
+			source, info, err := r.sourceFiles(ctx, page)
+			Expect(err).NotTo(HaveOccurred())
+			_, err = newTemplateData(web, siblings, now, false).renderFiles(page, source)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(r.recordRevision(ctx, page, source, info)).To(Succeed())
+		}
+		Expect(revisionCMs()).To(HaveLen(1))
+		Expect(page.Status.Revisions).To(HaveLen(1))
+	})
+
+	It("renders the stored revision when rolled back", func() {
+		source, info, err := r.sourceFiles(ctx, page)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.recordRevision(ctx, page, source, info)).To(Succeed())
+		revision := page.Status.Revision
+
+		page.Spec.Contents = "changed"
+		page.Spec.Revision = revision
+		siblings := []webidv1alpha1.Page{{Spec: webidv1alpha1.PageSpec{Name: "about.html"}}}
+		files, _, err := r.pageFiles(ctx, page, newTemplateData(web, siblings, now, false))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(files["index.html"])).To(Equal("about.html "))
+	})
+
+	It("reports a missing revision", func() {
+		page.Spec.Revision = "0123456789"
+		_, _, err := r.sourceFiles(ctx, page)
+		Expect(isPageError(err)).To(BeTrue())
+	})
+})
@@ -0,0 +1,300 @@
+package pages
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+)
+
+// droppedWithContents are elements removed together with their contents, other disallowed elements are unwrapped
+var droppedWithContents = set("script", "style", "iframe", "frame", "frameset", "object", "embed", "applet",
+	"noscript", "template")
+
+// basicDenied are elements stripped by the 'basic' policy
+var basicDenied = set("script", "iframe", "frame", "frameset", "object", "embed", "applet", "base")
+
+// strictElements and strictAttributes are kept by the 'strict' policy
+var (
+	strictElements = set("html", "head", "body", "title", "p", "br", "hr", "h1", "h2", "h3", "h4", "h5", "h6",
+		"ul", "ol", "li", "dl", "dt", "dd", "a", "strong", "em", "b", "i", "u", "s", "sub", "sup", "small", "mark",
+		"code", "pre", "blockquote", "q", "cite", "abbr", "img", "figure", "figcaption", "table", "caption",
+		"thead", "tbody", "tfoot", "tr", "th", "td", "span", "div", "section", "article", "header", "footer",
+		"nav", "main", "aside")
+	strictAttributes = set("href", "src", "alt", "title", "class", "id", "width", "height", "colspan", "rowspan",
+		"lang", "dir")
+)
+
+// urlAttributes are checked for script URLs
+var urlAttributes = set("href", "src", "action", "formaction", "xlink:href", "background", "poster")
+
+// animationElements are SVG elements, that can set an URL attribute (see attributeName) to the animated values
+var animationElements = set("animate", "set")
+
+// animationValues are attributes of the SVG animation elements holding the animated values
+var animationValues = set("values", "from", "to", "by")
+
+// scriptURL matches URLs, that execute scripts when followed (leading spaces and control characters are ignored
+// by browsers, tabs and newlines are removed by urlStripped)
+var scriptURL = regexp.MustCompile(`(?i)^[\x00-\x20]*(javascript|vbscript|data)\s*:`)
+
+// urlStripped removes ASCII tabs and newlines, that browsers remove from URLs ('java\tscript:')
+var urlStripped = strings.NewReplacer("\t", "", "\n", "", "\r", "")
+
+// activeXMLTypes are content types of XML documents, that can run scripts; activeXMLExtensions are served so
+var (
+	activeXMLTypes      = set("image/svg+xml", "application/xhtml+xml")
+	activeXMLExtensions = set(".svg", ".svgz", ".xhtml", ".xht")
+)
+
+// fullDocument matches contents, that are a whole HTML document (not a fragment)
+var fullDocument = regexp.MustCompile(`(?i)^\s*(<!--.*?-->\s*)*<(!doctype|html)`)
+
+func set(items ...string) map[string]bool {
+	m := make(map[string]bool, len(items))
+	for _, i := range items {
+		m[i] = true
+	}
+	return m
+}
+
+// sanitizer strips HTML elements and attributes not allowed by the sanitization policy of the web server
+type sanitizer struct {
+	// allowed elements, nil means all except denied
+	elements map[string]bool
+	denied   map[string]bool
+	// allowed attributes, nil means all except event handlers
+	attributes map[string]bool
+}
+
+// stripped collects the elements and attributes stripped from a page
+type stripped struct {
+	elements   map[string]bool
+	attributes map[string]bool
+}
+
+// newSanitizer returns the sanitizer of the web server, nil if the pages are published verbatim
+func newSanitizer(web *webidv1alpha1.WebServer) *sanitizer {
+	spec := web.Spec.Sanitize
+	if spec == nil {
+		return nil
+	}
+	switch spec.Policy {
+	case webidv1alpha1.SanitizeNone:
+		return nil
+	case webidv1alpha1.SanitizeStrict:
+		return &sanitizer{elements: strictElements, attributes: strictAttributes}
+	case webidv1alpha1.SanitizeCustom:
+		return &sanitizer{elements: set(append(spec.AllowedElements, "html", "head", "body")...),
+			attributes: set(spec.AllowedAttributes...)}
+	default:
+		return &sanitizer{denied: basicDenied}
+	}
+}
+
+// sanitizeFiles returns the files with sanitized HTML (the files are not modified) and the sorted lists
+// of the stripped elements and attributes. It returns pageError if a file can not be sanitized, SVG and XHTML
+// files are refused (they can contain scripts).
+func (s *sanitizer) sanitizeFiles(files PageData, info PageInfo) (sanitized PageData, elements, attributes []string, err error) {
+	if s == nil {
+		return files, nil, nil, nil
+	}
+	st := &stripped{elements: make(map[string]bool), attributes: make(map[string]bool)}
+	sanitized = make(PageData, len(files))
+	for name, contents := range files {
+		switch {
+		case isActiveXML(name, info[name].ContentType):
+			return nil, nil, nil, &pageError{reason: reasonSanitizeFailed,
+				msg: fmt.Sprintf("%s: SVG and XHTML files are not published with the sanitization policy", name)}
+		case IsHTML(name, info[name].ContentType):
+			if sanitized[name], err = s.sanitize(contents, st); err != nil {
+				return nil, nil, nil, &pageError{reason: reasonSanitizeFailed, msg: fmt.Sprintf("%s: %s", name, err)}
+			}
+		default:
+			sanitized[name] = contents
+		}
+	}
+	return sanitized, sortedKeys(st.elements), sortedKeys(st.attributes), nil
+}
+
+// sanitize returns the sanitized contents, they are returned unchanged if nothing is stripped
+func (s *sanitizer) sanitize(contents []byte, st *stripped) ([]byte, error) {
+	var nodes []*html.Node
+	if fullDocument.Match(contents) {
+		doc, err := html.Parse(bytes.NewReader(contents))
+		if err != nil {
+			return nil, err
+		}
+		nodes = []*html.Node{doc}
+	} else {
+		body := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+		var err error
+		if nodes, err = html.ParseFragment(bytes.NewReader(contents), body); err != nil {
+			return nil, err
+		}
+		for _, n := range nodes {
+			body.AppendChild(n)
+		}
+		nodes = []*html.Node{body}
+	}
+
+	changed := false
+	for _, n := range nodes {
+		changed = s.clean(n, st) || changed
+	}
+	if !changed {
+		return contents, nil
+	}
+
+	buf := &bytes.Buffer{}
+	if nodes[0].Type == html.DocumentNode {
+		if err := html.Render(buf, nodes[0]); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	for c := nodes[0].FirstChild; c != nil; c = c.NextSibling {
+		if err := html.Render(buf, c); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// clean strips the disallowed descendants and attributes of the node, it returns true if anything was stripped
+func (s *sanitizer) clean(n *html.Node, st *stripped) bool {
+	changed := false
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type != html.ElementNode {
+			c = next
+			continue
+		}
+		name := strings.ToLower(c.Data)
+		allowed := !s.denied[name] && (s.elements == nil || s.elements[name])
+		if !allowed && droppedWithContents[name] {
+			st.elements[name] = true
+			n.RemoveChild(c)
+			changed = true
+			c = next
+			continue
+		}
+
+		if allowed {
+			changed = s.cleanAttributes(c, st) || changed
+		}
+		changed = s.clean(c, st) || changed
+		if !allowed {
+			// unwrap - keep the (already cleaned) children
+			st.elements[name] = true
+			for gc := c.FirstChild; gc != nil; gc = c.FirstChild {
+				c.RemoveChild(gc)
+				n.InsertBefore(gc, c)
+			}
+			n.RemoveChild(c)
+			changed = true
+		}
+		c = next
+	}
+	return changed
+}
+
+// cleanAttributes strips the disallowed attributes of the element, event handlers and script URLs
+// (including the values of SVG animations of URL attributes)
+func (s *sanitizer) cleanAttributes(n *html.Node, st *stripped) bool {
+	animatesURL := animationElements[strings.ToLower(n.Data)] && urlAttributes[strings.ToLower(attribute(n, "attributename"))]
+	attrs := n.Attr[:0]
+	for _, a := range n.Attr {
+		key := strings.ToLower(a.Key)
+		allowed := s.attributes[key] || (s.attributes == nil && !strings.HasPrefix(key, "on"))
+		if urlAttributes[key] && isScriptURL(a.Val) && !(key == "src" && isDataImage(a.Val)) {
+			allowed = false
+		}
+		if animatesURL && animationValues[key] && hasScriptURL(strings.Split(a.Val, ";")) {
+			allowed = false
+		}
+		if !allowed {
+			st.attributes[strings.ToLower(n.Data)+"["+key+"]"] = true
+			continue
+		}
+		attrs = append(attrs, a)
+	}
+	changed := len(attrs) != len(n.Attr)
+	n.Attr = attrs
+	return changed
+}
+
+// attribute returns the value of the attribute of the element (the key is compared case insensitive)
+func attribute(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if strings.EqualFold(a.Key, key) {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// isScriptURL returns true if the URL executes a script when followed
+func isScriptURL(url string) bool {
+	return scriptURL.MatchString(urlStripped.Replace(url))
+}
+
+// hasScriptURL returns true if any of the URLs executes a script
+func hasScriptURL(urls []string) bool {
+	for _, url := range urls {
+		if isScriptURL(url) {
+			return true
+		}
+	}
+	return false
+}
+
+// isDataImage returns true for inline images ('data:image/...'), except SVG that can contain scripts
+func isDataImage(url string) bool {
+	url = strings.TrimLeftFunc(urlStripped.Replace(url), func(r rune) bool { return r <= ' ' })
+	url = strings.ToLower(url)
+	return strings.HasPrefix(url, "data:image/") && !strings.HasPrefix(url, "data:image/svg")
+}
+
+// isActiveXML returns true if the file is served as SVG or XHTML
+func isActiveXML(name, contentType string) bool {
+	if contentType != "" {
+		return activeXMLTypes[contentType]
+	}
+	return activeXMLExtensions[strings.ToLower(filepath.Ext(name))]
+}
+
+// IsHTML returns true if the file is served as HTML - by its content type, by the nginx mime types of the extension,
+// or by the nginx default type if it has no extension (see Sanitized for other unknown extensions)
+func IsHTML(name, contentType string) bool {
+	if contentType != "" {
+		return contentType == "text/html"
+	}
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == "" || ext == ".html" || ext == ".htm" || ext == ".shtml"
+}
+
+// Sanitized returns true if the pages of the web server are sanitized, files with unknown extensions must not be
+// served as HTML then (they are not sanitized)
+func Sanitized(web *webidv1alpha1.WebServer) bool {
+	return newSanitizer(web) != nil
+}
+
+func sortedKeys(m map[string]bool) []string {
+	if len(m) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
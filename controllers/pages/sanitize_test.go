@@ -0,0 +1,120 @@
+package pages
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+)
+
+var _ = Describe("sanitizer", func() {
+	policy := func(p webidv1alpha1.SanitizePolicy) *sanitizer {
+		return newSanitizer(&webidv1alpha1.WebServer{Spec: webidv1alpha1.WebServerSpec{
+			Sanitize: &webidv1alpha1.SanitizeSpec{Policy: p, AllowedElements: []string{"p"}, AllowedAttributes: []string{"class"}},
+		}})
+	}
+	sanitize := func(s *sanitizer, contents string) (string, []string, []string) {
+		files, elements, attributes, err := s.sanitizeFiles(PageData{"index.html": []byte(contents)}, PageInfo{})
+		Expect(err).NotTo(HaveOccurred())
+		return string(files["index.html"]), elements, attributes
+	}
+
+	It("publishes verbatim without a policy", func() {
+		Expect(newSanitizer(&webidv1alpha1.WebServer{})).To(BeNil())
+		Expect(policy(webidv1alpha1.SanitizeNone)).To(BeNil())
+		out, elements, _ := sanitize(nil, "<script>x</script>")
+		Expect(out).To(Equal("<script>x</script>"))
+		Expect(elements).To(BeNil())
+	})
+
+	DescribeTable("basic policy",
+		func(in, out string, attributes []string) {
+			got, _, stripped := sanitize(policy(webidv1alpha1.SanitizeBasic), in)
+			Expect(got).To(Equal(out))
+			Expect(stripped).To(Equal(attributes))
+		},
+		Entry("unchanged", `<p class="x">hi</p>`, `<p class="x">hi</p>`, nil),
+		Entry("script dropped", `<p>a<script>alert(1)</script></p>`, `<p>a</p>`, nil),
+		Entry("event handler", `<img src="x.png" onerror="alert(1)">`, `<img src="x.png"/>`, []string{"img[onerror]"}),
+		Entry("javascript URL", `<a href="javascript:alert(1)">x</a>`, `<a>x</a>`, []string{"a[href]"}),
+		Entry("javascript URL with tab", "<a href=\"java\tscript:alert(1)\">x</a>", `<a>x</a>`, []string{"a[href]"}),
+		Entry("javascript URL with newline", "<a href=\"\njava\r\nscript:alert(1)\">x</a>", `<a>x</a>`, []string{"a[href]"}),
+		Entry("javascript URL with control characters", "<a href=\"\x01 javascript:alert(1)\">x</a>", `<a>x</a>`, []string{"a[href]"}),
+		Entry("data image kept", `<img src="data:image/png;base64,AA==">`, `<img src="data:image/png;base64,AA==">`, nil),
+		Entry("data SVG image", `<img src="data:image/svg+xml,<svg/>">`, `<img/>`, []string{"img[src]"}),
+		Entry("SVG animation of href",
+			`<svg><a><animate attributeName="href" values="https://x;javascript:alert(1)"></animate><text>x</text></a></svg>`,
+			`<svg><a><animate attributeName="href"></animate><text>x</text></a></svg>`, []string{"animate[values]"}),
+		Entry("SVG set of xlink:href",
+			`<svg><a><set attributeName="xlink:href" to="javascript:alert(1)"></set></a></svg>`,
+			`<svg><a><set attributeName="xlink:href"></set></a></svg>`, []string{"set[to]"}),
+		Entry("SVG animation of other attribute", `<svg><animate attributeName="x" values="javascript:1"></animate></svg>`,
+			`<svg><animate attributeName="x" values="javascript:1"></animate></svg>`, nil),
+	)
+
+	It("keeps only allowed elements with the strict policy", func() {
+		out, elements, attributes := sanitize(policy(webidv1alpha1.SanitizeStrict),
+			`<p style="x">a</p><form><input name="q"/></form><style>p{}</style>`)
+		Expect(out).To(Equal(`<p>a</p>`))
+		Expect(elements).To(Equal([]string{"form", "input", "style"}))
+		Expect(attributes).To(Equal([]string{"p[style]"}))
+	})
+
+	It("keeps only listed elements and attributes with the custom policy", func() {
+		out, elements, attributes := sanitize(policy(webidv1alpha1.SanitizeCustom), `<p class="a" id="b"><b>x</b></p>`)
+		Expect(out).To(Equal(`<p class="a">x</p>`))
+		Expect(elements).To(Equal([]string{"b"}))
+		Expect(attributes).To(Equal([]string{"p[id]"}))
+	})
+
+	It("sanitizes whole documents", func() {
+		out, _, _ := sanitize(policy(webidv1alpha1.SanitizeBasic),
+			`<!DOCTYPE html><html><head><script>x</script></head><body>hi</body></html>`)
+		Expect(out).To(Equal(`<!DOCTYPE html><html><head></head><body>hi</body></html>`))
+	})
+
+	It("does not modify the files", func() {
+		files := PageData{"index.html": []byte("<script>x</script>")}
+		_, _, _, err := policy(webidv1alpha1.SanitizeBasic).sanitizeFiles(files, PageInfo{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(files["index.html"])).To(Equal("<script>x</script>"))
+	})
+
+	It("does not sanitize other files", func() {
+		files := PageData{"app.js": []byte("<script>")}
+		out, _, _, err := policy(webidv1alpha1.SanitizeBasic).sanitizeFiles(files, PageInfo{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out).To(Equal(files))
+	})
+
+	DescribeTable("sanitizes the files nginx serves as HTML",
+		func(name, contentType string, sanitized bool) {
+			files := PageData{name: []byte("<p>a<script>x</script></p>")}
+			out, _, _, err := policy(webidv1alpha1.SanitizeBasic).sanitizeFiles(files, PageInfo{name: {ContentType: contentType}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(out[name]) == "<p>a</p>").To(Equal(sanitized))
+		},
+		Entry("no extension", "about", "", true),
+		Entry("SHTML", "page.shtml", "", true),
+		Entry("HTML type of other extension", "page.foo", "text/html", true),
+		// served as application/octet-stream with the sanitization policy, see Sanitized
+		Entry("unknown extension", "page.foo", "", false),
+	)
+
+	DescribeTable("refuses SVG and XHTML",
+		func(name, contentType string) {
+			files := PageData{name: []byte(`<svg onload="alert(1)"/>`)}
+			info := PageInfo{name: {ContentType: contentType}}
+			_, _, _, err := policy(webidv1alpha1.SanitizeBasic).sanitizeFiles(files, info)
+			Expect(isPageError(err)).To(BeTrue())
+			Expect(err.(*pageError).reason).To(Equal(reasonSanitizeFailed))
+
+			_, _, _, err = (*sanitizer)(nil).sanitizeFiles(files, info)
+			Expect(err).NotTo(HaveOccurred())
+		},
+		Entry("SVG by extension", "logo.svg", ""),
+		Entry("XHTML by extension", "page.xhtml", ""),
+		Entry("SVG by type", "logo", "image/svg+xml"),
+		Entry("XHTML by type", "page.html", "application/xhtml+xml"),
+	)
+})
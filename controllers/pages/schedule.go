@@ -0,0 +1,58 @@
+package pages
+
+import (
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+)
+
+const (
+	typePublished = "Published"
+
+	reasonScheduled = "Scheduled"
+	reasonPublished = "Published"
+	reasonExpired   = "Expired"
+)
+
+// isPublished returns true if the page shall be served at the given time (see spec.publishAt, spec.expireAt)
+func isPublished(page *webidv1alpha1.Page, now time.Time) bool {
+	if page.Spec.PublishAt != nil && now.Before(page.Spec.PublishAt.Time) {
+		return false
+	}
+	if page.Spec.ExpireAt != nil && !now.Before(page.Spec.ExpireAt.Time) {
+		return false
+	}
+	return true
+}
+
+// nextTransition returns the duration to the next publish/expire time of the page, 0 if there is none
+func nextTransition(page *webidv1alpha1.Page, now time.Time) time.Duration {
+	for _, t := range []*metav1.Time{page.Spec.PublishAt, page.Spec.ExpireAt} {
+		if t != nil && now.Before(t.Time) {
+			return t.Sub(now)
+		}
+	}
+	return 0
+}
+
+// scheduleCondition returns the Published condition reporting the schedule of the page
+func scheduleCondition(page *webidv1alpha1.Page, now time.Time) metav1.Condition {
+	switch {
+	case page.Spec.ExpireAt != nil && !now.Before(page.Spec.ExpireAt.Time):
+		return metav1.Condition{Type: typePublished, Status: metav1.ConditionFalse, Reason: reasonExpired,
+			Message: "Page expired at " + page.Spec.ExpireAt.UTC().Format(time.RFC3339)}
+	case page.Spec.PublishAt != nil && now.Before(page.Spec.PublishAt.Time):
+		msg := "Page is scheduled to be published at " + page.Spec.PublishAt.UTC().Format(time.RFC3339)
+		if page.Spec.ExpireAt != nil {
+			msg += ", expires at " + page.Spec.ExpireAt.UTC().Format(time.RFC3339)
+		}
+		return metav1.Condition{Type: typePublished, Status: metav1.ConditionFalse, Reason: reasonScheduled, Message: msg}
+	}
+	msg := "Page is published"
+	if page.Spec.ExpireAt != nil {
+		msg += ", expires at " + page.Spec.ExpireAt.UTC().Format(time.RFC3339)
+	}
+	return metav1.Condition{Type: typePublished, Status: metav1.ConditionTrue, Reason: reasonPublished, Message: msg}
+}
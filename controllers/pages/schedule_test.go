@@ -0,0 +1,43 @@
+package pages
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+)
+
+var _ = Describe("schedule", func() {
+	now := time.Date(2024, time.June, 15, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *metav1.Time { return &metav1.Time{Time: now.Add(d)} }
+	page := func(publishAt, expireAt *metav1.Time) *webidv1alpha1.Page {
+		return &webidv1alpha1.Page{Spec: webidv1alpha1.PageSpec{PublishAt: publishAt, ExpireAt: expireAt}}
+	}
+
+	DescribeTable("isPublished, nextTransition and scheduleCondition",
+		func(p *webidv1alpha1.Page, published bool, next time.Duration, reason string) {
+			Expect(isPublished(p, now)).To(Equal(published))
+			Expect(nextTransition(p, now)).To(Equal(next))
+			condition := scheduleCondition(p, now)
+			Expect(condition.Reason).To(Equal(reason))
+			Expect(condition.Status == metav1.ConditionTrue).To(Equal(published))
+		},
+		Entry("not scheduled", page(nil, nil), true, time.Duration(0), reasonPublished),
+		Entry("scheduled", page(at(time.Hour), nil), false, time.Hour, reasonScheduled),
+		Entry("scheduled with expiry", page(at(time.Hour), at(2*time.Hour)), false, time.Hour, reasonScheduled),
+		Entry("published at exactly now", page(at(0), nil), true, time.Duration(0), reasonPublished),
+		Entry("published, expires later", page(at(-time.Hour), at(time.Minute)), true, time.Minute, reasonPublished),
+		Entry("expired at exactly now", page(nil, at(0)), false, time.Duration(0), reasonExpired),
+		Entry("expired", page(at(-2*time.Hour), at(-time.Hour)), false, time.Duration(0), reasonExpired),
+	)
+
+	It("reports the times in the condition message", func() {
+		condition := scheduleCondition(page(at(time.Hour), at(2*time.Hour)), now)
+		Expect(condition.Message).To(Equal("Page is scheduled to be published at 2024-06-15T13:00:00Z, expires at 2024-06-15T14:00:00Z"))
+		Expect(scheduleCondition(page(nil, at(time.Hour)), now).Message).To(Equal("Page is published, expires at 2024-06-15T13:00:00Z"))
+	})
+})
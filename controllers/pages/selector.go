@@ -0,0 +1,202 @@
+package pages
+
+import (
+	"context"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+)
+
+const (
+	// PageSelectorKey indexes web servers with spec.pageSelector by the namespace of the selected pages,
+	// AnyNamespace if spec.pageSelector.namespaceSelector is set
+	PageSelectorKey = "spec.pageSelector"
+	// AnyNamespace is the PageSelectorKey index value of web servers selecting pages from other namespaces
+	AnyNamespace = "*"
+)
+
+// selectedNamespaces is the index function of PageSelectorKey
+func selectedNamespaces(rawObj client.Object) []string {
+	web := rawObj.(*webidv1alpha1.WebServer)
+	switch {
+	case web.Spec.PageSelector == nil:
+		return nil
+	case web.Spec.PageSelector.NamespaceSelector == nil:
+		return []string{web.Namespace}
+	default:
+		return []string{AnyNamespace}
+	}
+}
+
+// namespaceMatcher checks namespace labels against selectors and Select PageGrants of the namespaces,
+// the labels and grants are cached for the lifetime of the matcher
+type namespaceMatcher struct {
+	client   client.Client
+	nsLabels map[string]labels.Set
+	grants   map[string]*grants
+}
+
+func newNamespaceMatcher(c client.Client) *namespaceMatcher {
+	return &namespaceMatcher{client: c, nsLabels: make(map[string]labels.Set), grants: make(map[string]*grants)}
+}
+
+// matches returns true if labels of the namespace match the selector
+func (m *namespaceMatcher) matches(ctx context.Context, selector *metav1.LabelSelector, namespace string) (bool, error) {
+	sel, err := metav1.LabelSelectorAsSelector(selector)
+	if err != nil {
+		return false, err
+	}
+	nsLabels, ok := m.nsLabels[namespace]
+	if !ok {
+		ns := &corev1.Namespace{}
+		if err := m.client.Get(ctx, types.NamespacedName{Name: namespace}, ns); err != nil {
+			return false, err
+		}
+		nsLabels = ns.Labels
+		m.nsLabels[namespace] = nsLabels
+	}
+	return sel.Matches(nsLabels), nil
+}
+
+// allowed returns true if the namespace of the page is selected by the web server: it is the namespace of the web
+// server, or it matches spec.pageSelector.namespaceSelector and a Select PageGrant in it allows the web server
+func (m *namespaceMatcher) allowed(ctx context.Context, web *webidv1alpha1.WebServer, page *webidv1alpha1.Page) (bool, error) {
+	ps := web.Spec.PageSelector
+	if page.Namespace == web.Namespace {
+		return true, nil
+	}
+	if ps.NamespaceSelector == nil {
+		return false, nil
+	}
+	ok, err := m.matches(ctx, ps.NamespaceSelector, page.Namespace)
+	if err != nil || !ok {
+		return false, err
+	}
+	g, ok := m.grants[page.Namespace]
+	if !ok {
+		if g, err = listGrants(ctx, m.client, page.Namespace, webidv1alpha1.PageGrantSelect); err != nil {
+			return false, err
+		}
+		m.grants[page.Namespace] = g
+	}
+	return g.allows(ctx, types.NamespacedName{Namespace: web.Namespace, Name: web.Name}, page)
+}
+
+// selects returns true if spec.pageSelector of the web server selects the page
+func (m *namespaceMatcher) selects(ctx context.Context, web *webidv1alpha1.WebServer, page *webidv1alpha1.Page) (bool, error) {
+	ps := web.Spec.PageSelector
+	if ps == nil {
+		return false, nil
+	}
+	sel, err := metav1.LabelSelectorAsSelector(&ps.LabelSelector)
+	if err != nil {
+		return false, err
+	}
+	if !sel.Matches(labels.Set(page.Labels)) {
+		return false, nil
+	}
+	return m.allowed(ctx, web, page)
+}
+
+// selectedPages returns pages selected by spec.pageSelector of the web server
+func (r *Reconciler) selectedPages(ctx context.Context, web *webidv1alpha1.WebServer) ([]webidv1alpha1.Page, error) {
+	ps := web.Spec.PageSelector
+	if ps == nil {
+		return nil, nil
+	}
+	sel, err := metav1.LabelSelectorAsSelector(&ps.LabelSelector)
+	if err != nil {
+		return nil, err
+	}
+	opts := []client.ListOption{client.MatchingLabelsSelector{Selector: sel}}
+	if ps.NamespaceSelector == nil {
+		opts = append(opts, client.InNamespace(web.Namespace))
+	}
+	list := &webidv1alpha1.PageList{}
+	if err = r.List(ctx, list, opts...); err != nil {
+		return nil, err
+	}
+	if ps.NamespaceSelector == nil {
+		return list.Items, nil
+	}
+
+	m := newNamespaceMatcher(r.Client)
+	pages := make([]webidv1alpha1.Page, 0, len(list.Items))
+	for i := range list.Items {
+		ok, err := m.allowed(ctx, web, &list.Items[i])
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			pages = append(pages, list.Items[i])
+		}
+	}
+	return pages, nil
+}
+
+// SelectingWebServers returns web servers, whose spec.pageSelector selects the page (sorted by namespace/name),
+// only web servers selecting the namespace of the page are checked (using index)
+func SelectingWebServers(ctx context.Context, c client.Client, page *webidv1alpha1.Page) ([]webidv1alpha1.WebServer, error) {
+	var candidates []webidv1alpha1.WebServer
+	for _, namespace := range []string{page.Namespace, AnyNamespace} {
+		list := &webidv1alpha1.WebServerList{}
+		if err := c.List(ctx, list, client.MatchingFields{PageSelectorKey: namespace}); err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, list.Items...)
+	}
+	m := newNamespaceMatcher(c)
+	webs := []webidv1alpha1.WebServer{}
+	for i := range candidates {
+		ok, err := m.selects(ctx, &candidates[i], page)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			webs = append(webs, candidates[i])
+		}
+	}
+	sort.Slice(webs, func(i, j int) bool {
+		if webs[i].Namespace != webs[j].Namespace {
+			return webs[i].Namespace < webs[j].Namespace
+		}
+		return webs[i].Name < webs[j].Name
+	})
+	return webs, nil
+}
+
+// pageWebServer returns the web server the page is checked against (templates, preview URL): the referenced one,
+// or the first one selecting the page. It returns also the WebServerMissing condition, web is nil if it is missing.
+func (r *Reconciler) pageWebServer(ctx context.Context, page *webidv1alpha1.Page) (*webidv1alpha1.WebServer, metav1.Condition, error) {
+	found := metav1.Condition{Type: typeWebServerMissing, Status: metav1.ConditionFalse, Reason: "Found", Message: "WebServer found"}
+	if page.Spec.WebServer != "" {
+		ref := WebServerRef(page)
+		web, err := r.getWebServer(ctx, ref)
+		if web == nil {
+			return nil, metav1.Condition{Type: typeWebServerMissing, Status: metav1.ConditionTrue, Reason: "NotFound",
+				Message: "WebServer " + ref.String() + " not found"}, err
+		}
+		return web, found, nil
+	}
+
+	webs, err := SelectingWebServers(ctx, r.Client, page)
+	if err != nil {
+		return nil, found, err
+	}
+	if len(webs) == 0 {
+		return nil, metav1.Condition{Type: typeWebServerMissing, Status: metav1.ConditionTrue, Reason: "NotSelected",
+			Message: "Page does not reference a WebServer and no WebServer selects it"}, nil
+	}
+	return &webs[0], found, nil
+}
+
+// pageKey returns 'namespace/name' of the page object
+func pageKey(page *webidv1alpha1.Page) string {
+	return types.NamespacedName{Namespace: page.Namespace, Name: page.Name}.String()
+}
@@ -0,0 +1,101 @@
+package pages
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+)
+
+var _ = Describe("page selector", func() {
+	ctx := context.Background()
+	selector := &webidv1alpha1.PageSelector{
+		LabelSelector:     metav1.LabelSelector{MatchLabels: map[string]string{"mirror": "public"}},
+		NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"docs": "true"}},
+	}
+	web := &webidv1alpha1.WebServer{ObjectMeta: metav1.ObjectMeta{Namespace: "docs", Name: "public"},
+		Spec: webidv1alpha1.WebServerSpec{PageSelector: selector}}
+	local := &webidv1alpha1.WebServer{ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: "internal"},
+		Spec: webidv1alpha1.WebServerSpec{PageSelector: &webidv1alpha1.PageSelector{LabelSelector: selector.LabelSelector}}}
+	page := &webidv1alpha1.Page{ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: "index",
+		Labels: map[string]string{"mirror": "public"}}}
+	namespace := func(name string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: map[string]string{"docs": "true"}}}
+	}
+	grant := func(typ webidv1alpha1.PageGrantType, from string) *webidv1alpha1.PageGrant {
+		return &webidv1alpha1.PageGrant{ObjectMeta: metav1.ObjectMeta{Namespace: "team", Name: "grant"},
+			Spec: webidv1alpha1.PageGrantSpec{Type: typ, From: []webidv1alpha1.PageGrantFrom{{Namespace: from}}}}
+	}
+	newReconciler := func(objs ...client.Object) *Reconciler {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(webidv1alpha1.AddToScheme(scheme)).To(Succeed())
+		objs = append(objs, namespace("docs"), namespace("team"), web, local, page)
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).
+			WithIndex(&webidv1alpha1.WebServer{}, PageSelectorKey, selectedNamespaces).Build()
+		return &Reconciler{Client: c, Scheme: scheme}
+	}
+	names := func(webs []webidv1alpha1.WebServer) []string {
+		var names []string
+		for _, web := range webs {
+			names = append(names, web.Namespace+"/"+web.Name)
+		}
+		return names
+	}
+
+	DescribeTable("selectedNamespaces",
+		func(web *webidv1alpha1.WebServer, expected []string) {
+			Expect(selectedNamespaces(web)).To(Equal(expected))
+		},
+		Entry("no selector", &webidv1alpha1.WebServer{}, nil),
+		Entry("own namespace", local, []string{"team"}),
+		Entry("other namespaces", web, []string{AnyNamespace}),
+	)
+
+	It("does not select pages from other namespaces without a Select grant", func() {
+		r := newReconciler()
+		webs, err := SelectingWebServers(ctx, r.Client, page)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names(webs)).To(Equal([]string{"team/internal"}))
+
+		pages, err := r.selectedPages(ctx, web)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pages).To(BeEmpty())
+	})
+
+	It("does not accept a Publish grant for selection", func() {
+		r := newReconciler(grant(webidv1alpha1.PageGrantPublish, "docs"))
+		pages, err := r.selectedPages(ctx, web)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pages).To(BeEmpty())
+	})
+
+	It("selects pages from namespaces granting the selection", func() {
+		r := newReconciler(grant(webidv1alpha1.PageGrantSelect, "docs"))
+		webs, err := SelectingWebServers(ctx, r.Client, page)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(names(webs)).To(Equal([]string{"docs/public", "team/internal"}))
+
+		pages, err := r.selectedPages(ctx, web)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(pages).To(HaveLen(1))
+	})
+
+	It("does not accept a Select grant for publishing", func() {
+		r := newReconciler(grant(webidv1alpha1.PageGrantSelect, "other"))
+		g, err := listGrants(ctx, r.Client, "team", webidv1alpha1.PageGrantPublish)
+		Expect(err).NotTo(HaveOccurred())
+		other := &webidv1alpha1.Page{ObjectMeta: metav1.ObjectMeta{Namespace: "other", Name: "p"}}
+		Expect(g.allows(ctx, types.NamespacedName{Namespace: "team", Name: "internal"}, other)).To(BeFalse())
+	})
+})
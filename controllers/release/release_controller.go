@@ -0,0 +1,173 @@
+package release
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+	"github.com/tomasji/webid-operator/controllers/pages"
+)
+
+// Reconciler reconciles a Release object
+type Reconciler struct {
+	client.Client
+	Scheme       *runtime.Scheme
+	DataProvider pages.DataProvider
+}
+
+const (
+	// releaseLabel is set on the ConfigMap with the frozen pages, value is the Release name
+	releaseLabel = "webid.golang.betsys.com/release"
+
+	typeReady = "Ready"
+
+	// waitInterval is the delay to check again, whether the pages of the WebServer are ready to be frozen
+	waitInterval = 5 * time.Second
+)
+
+//+kubebuilder:rbac:groups=webid.golang.betsys.com,resources=releases,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=webid.golang.betsys.com,resources=releases/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=webid.golang.betsys.com,resources=releases/finalizers,verbs=update
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create
+
+// Reconcile freezes the rendered pages of the WebServer into an immutable ConfigMap, once.
+// The snapshot is never updated, a new Release shall be created to publish newer pages.
+func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := log.FromContext(ctx)
+	debug := log.V(1).Info
+
+	// Get the Release object
+	rel := &webidv1alpha1.Release{}
+	if err := r.Get(ctx, req.NamespacedName, rel); err != nil {
+		if apierrors.IsNotFound(err) {
+			log.Info("Release resource not found. Ignoring since object must be deleted")
+			return ctrl.Result{}, nil
+		}
+		log.Error(err, "Failed to get Release")
+		return ctrl.Result{}, err
+	}
+	debug("Reconcile: got object:", "release", rel.Name)
+
+	// already frozen - just check the snapshot still exists
+	if rel.Status.ConfigMap != "" {
+		cm := &corev1.ConfigMap{}
+		err := r.Get(ctx, types.NamespacedName{Namespace: rel.Namespace, Name: rel.Status.ConfigMap}, cm)
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, r.setStatus(ctx, rel, metav1.ConditionFalse, "SnapshotLost",
+				"ConfigMap "+rel.Status.ConfigMap+" with the frozen pages not found")
+		}
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, r.setStatus(ctx, rel, metav1.ConditionTrue, "Frozen", "Pages frozen")
+	}
+
+	// the pages must be prepared and published by the WebServer, before they are frozen
+	webNsName := types.NamespacedName{Namespace: rel.Namespace, Name: rel.Spec.WebServer}
+	web := &webidv1alpha1.WebServer{}
+	if err := r.Get(ctx, webNsName, web); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{RequeueAfter: waitInterval}, r.setStatus(ctx, rel, metav1.ConditionFalse,
+				"WebServerNotFound", "WebServer "+rel.Spec.WebServer+" not found")
+		}
+		return ctrl.Result{}, err
+	}
+	data := r.DataProvider.GetData(webNsName)
+	if data == nil || !meta.IsStatusConditionTrue(web.Status.Conditions, "UpToDate") {
+		debug("WebServer pages are not ready yet", "webserver", web.Name)
+		return ctrl.Result{RequeueAfter: waitInterval}, r.setStatus(ctx, rel, metav1.ConditionFalse,
+			"WaitingForWebServer", "Waiting for pages of WebServer "+web.Name+" to be published")
+	}
+	info := r.DataProvider.GetInfo(webNsName)
+
+	hash := pages.Hash(data, info)
+	cmName, err := r.createSnapshot(ctx, rel, hash, data, info)
+	if err != nil {
+		log.Error(err, "Failed to create snapshot")
+		return ctrl.Result{}, err
+	}
+
+	rel.Status.Hash = hash
+	rel.Status.ConfigMap = cmName
+	rel.Status.Files = len(data)
+	if err = r.setStatus(ctx, rel, metav1.ConditionTrue, "Frozen", "Pages frozen"); err != nil {
+		return ctrl.Result{}, err
+	}
+	debug("Reconcile: completed", "hash", hash)
+	return ctrl.Result{}, nil
+}
+
+// createSnapshot creates the immutable ConfigMap with the pages, set ownership to the release
+func (r *Reconciler) createSnapshot(ctx context.Context, rel *webidv1alpha1.Release, hash string,
+	data map[string][]byte, info pages.PageInfo,
+) (string, error) {
+	log := log.FromContext(ctx)
+
+	types, err := pages.MarshalInfo(info)
+	if err != nil {
+		return "", err
+	}
+	immutable := true
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      rel.Name + "-" + hash[:10],
+			Namespace: rel.Namespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/part-of": "webid-operator",
+				releaseLabel:                rel.Name,
+			},
+			Annotations: map[string]string{pages.ContentTypesAnnotation: types},
+		},
+		Immutable:  &immutable,
+		BinaryData: data,
+	}
+	if err = ctrl.SetControllerReference(rel, cm, r.Scheme); err != nil {
+		return "", err
+	}
+
+	log.Info("Creating a new ConfigMap with frozen pages", "namespace", cm.Namespace, "name", cm.Name)
+	if err = r.Create(ctx, cm); err != nil && !apierrors.IsAlreadyExists(err) {
+		return "", err
+	}
+	return cm.Name, nil
+}
+
+// setStatus updates the Ready condition (and the rest of the status) of the Release
+func (r *Reconciler) setStatus(ctx context.Context, rel *webidv1alpha1.Release,
+	status metav1.ConditionStatus, reason, message string,
+) error {
+	old := meta.FindStatusCondition(rel.Status.Conditions, typeReady)
+	if old != nil && old.Status == status && old.Reason == reason && old.Message == message &&
+		old.ObservedGeneration == rel.Generation {
+		return nil
+	}
+
+	meta.SetStatusCondition(&rel.Status.Conditions, metav1.Condition{Type: typeReady, Status: status,
+		Reason: reason, Message: message, ObservedGeneration: rel.Generation})
+	if err := r.Status().Update(ctx, rel); err != nil {
+		if !apierrors.IsConflict(err) {
+			log.FromContext(ctx).Error(err, "Failed to update Release status")
+		}
+		return err
+	}
+	return nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+// The snapshot ConfigMap is watched, so that its loss is reported.
+func (r *Reconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&webidv1alpha1.Release{}).
+		Owns(&corev1.ConfigMap{}).
+		Complete(r)
+}
@@ -0,0 +1,111 @@
+package release
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+	"github.com/tomasji/webid-operator/controllers/pages"
+)
+
+var _ = Describe("Release controller", func() {
+	ctx := context.Background()
+	webKey := types.NamespacedName{Namespace: "ns", Name: "web"}
+	relKey := types.NamespacedName{Namespace: "ns", Name: "v1"}
+	var (
+		r    *Reconciler
+		data *pages.Reconciler
+		web  *webidv1alpha1.WebServer
+	)
+
+	newReconciler := func(objs ...client.Object) {
+		scheme := runtime.NewScheme()
+		Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+		Expect(webidv1alpha1.AddToScheme(scheme)).To(Succeed())
+		rel := &webidv1alpha1.Release{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "v1", UID: "rel-uid"},
+			Spec: webidv1alpha1.ReleaseSpec{WebServer: "web"}}
+		c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(append(objs, rel)...).Build()
+		r = &Reconciler{Client: c, Scheme: scheme, DataProvider: data}
+	}
+	reconcile := func() (ctrl.Result, *webidv1alpha1.Release) {
+		res, err := r.Reconcile(ctx, ctrl.Request{NamespacedName: relKey})
+		Expect(err).NotTo(HaveOccurred())
+		rel := &webidv1alpha1.Release{}
+		Expect(r.Get(ctx, relKey, rel)).To(Succeed())
+		return res, rel
+	}
+	ready := func(rel *webidv1alpha1.Release) *metav1.Condition {
+		return meta.FindStatusCondition(rel.Status.Conditions, typeReady)
+	}
+
+	BeforeEach(func() {
+		data = &pages.Reconciler{
+			Data: make(map[types.NamespacedName]pages.PageData),
+			Info: make(map[types.NamespacedName]pages.PageInfo),
+		}
+		web = &webidv1alpha1.WebServer{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web"}}
+	})
+
+	It("waits for the WebServer", func() {
+		newReconciler()
+		res, rel := reconcile()
+		Expect(res.RequeueAfter).To(Equal(waitInterval))
+		Expect(ready(rel).Reason).To(Equal("WebServerNotFound"))
+	})
+
+	It("waits for the pages of the WebServer to be published", func() {
+		newReconciler(web)
+		data.SetData(webKey, pages.PageData{"index.html": []byte("x")}, pages.PageInfo{"index.html": {}})
+		res, rel := reconcile()
+		Expect(res.RequeueAfter).To(Equal(waitInterval))
+		Expect(ready(rel).Reason).To(Equal("WaitingForWebServer"))
+	})
+
+	It("freezes the published pages once", func() {
+		meta.SetStatusCondition(&web.Status.Conditions, metav1.Condition{Type: "UpToDate", Status: metav1.ConditionTrue, Reason: "Ready"})
+		newReconciler(web)
+		files, info := pages.PageData{"index.html": []byte("v1")}, pages.PageInfo{"index.html": {ContentType: "text/html"}}
+		data.SetData(webKey, files, info)
+
+		res, rel := reconcile()
+		Expect(res).To(Equal(ctrl.Result{}))
+		Expect(ready(rel).Status).To(Equal(metav1.ConditionTrue))
+		Expect(rel.Status.Hash).To(Equal(pages.Hash(files, info)))
+		Expect(rel.Status.Files).To(Equal(1))
+
+		cm := &corev1.ConfigMap{}
+		Expect(r.Get(ctx, types.NamespacedName{Namespace: "ns", Name: rel.Status.ConfigMap}, cm)).To(Succeed())
+		Expect(cm.BinaryData).To(Equal(map[string][]byte(files)))
+		Expect(*cm.Immutable).To(BeTrue())
+		Expect(metav1.IsControlledBy(cm, rel)).To(BeTrue())
+		Expect(pages.UnmarshalInfo(cm.Annotations[pages.ContentTypesAnnotation])).To(Equal(info))
+
+		// newer pages are not frozen into the existing release
+		data.SetData(webKey, pages.PageData{"index.html": []byte("v2")}, info)
+		_, again := reconcile()
+		Expect(again.Status.Hash).To(Equal(rel.Status.Hash))
+	})
+
+	It("reports a lost snapshot", func() {
+		newReconciler()
+		rel := &webidv1alpha1.Release{}
+		Expect(r.Get(ctx, relKey, rel)).To(Succeed())
+		rel.Status.ConfigMap = "v1-0123456789"
+		Expect(r.Status().Update(ctx, rel)).To(Succeed())
+
+		_, rel = reconcile()
+		Expect(ready(rel).Reason).To(Equal("SnapshotLost"))
+	})
+})
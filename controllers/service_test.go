@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+)
+
+var _ = Describe("WebServer service", func() {
+	const timeout, interval = 10 * time.Second, 100 * time.Millisecond
+	ctx := context.Background()
+	var key types.NamespacedName
+
+	service := func() *corev1.Service {
+		svc := &corev1.Service{}
+		Expect(k8sClient.Get(ctx, key, svc)).To(Succeed())
+		return svc
+	}
+	address := func() string {
+		web := &webidv1alpha1.WebServer{}
+		Expect(k8sClient.Get(ctx, key, web)).To(Succeed())
+		return web.Status.Address
+	}
+	setServiceIngress := func(lb ...corev1.LoadBalancerIngress) {
+		Eventually(func() error {
+			svc := service()
+			svc.Status.LoadBalancer.Ingress = lb
+			return k8sClient.Status().Update(ctx, svc)
+		}, timeout, interval).Should(Succeed())
+	}
+
+	BeforeEach(func() {
+		web := newWebServer(newNamespace(ctx), "web")
+		web.Spec.Service = &webidv1alpha1.ServiceSpec{
+			Type:            corev1.ServiceTypeLoadBalancer,
+			Port:            8080,
+			Annotations:     map[string]string{"service.beta.kubernetes.io/aws-load-balancer-internal": "true"},
+			SessionAffinity: corev1.ServiceAffinityClientIP,
+		}
+		key = types.NamespacedName{Namespace: web.Namespace, Name: web.Name}
+		Expect(k8sClient.Create(ctx, web)).To(Succeed())
+	})
+
+	It("creates the Service of spec.service and reports the load balancer address", func() {
+		Eventually(func() error {
+			return k8sClient.Get(ctx, key, &corev1.Service{})
+		}, timeout, interval).Should(Succeed())
+		svc := service()
+		Expect(svc.Spec.Type).To(Equal(corev1.ServiceTypeLoadBalancer))
+		Expect(svc.Spec.Ports).To(HaveLen(1))
+		Expect(svc.Spec.Ports[0].Port).To(Equal(int32(8080)))
+		Expect(svc.Spec.Ports[0].TargetPort).To(Equal(intstr.FromString("http")))
+		Expect(svc.Spec.SessionAffinity).To(Equal(corev1.ServiceAffinityClientIP))
+		Expect(svc.Annotations).To(HaveKeyWithValue("service.beta.kubernetes.io/aws-load-balancer-internal", "true"))
+		Expect(address()).To(BeEmpty())
+
+		By("reporting the IP of the load balancer")
+		setServiceIngress(corev1.LoadBalancerIngress{IP: "192.0.2.10"})
+		Eventually(address, timeout, interval).Should(Equal("192.0.2.10"))
+
+		By("reporting the host name of the load balancer")
+		setServiceIngress(corev1.LoadBalancerIngress{Hostname: "lb.example.com"})
+		Eventually(address, timeout, interval).Should(Equal("lb.example.com"))
+	})
+
+	It("updates the Service when spec.service changes, the Ingress address is reported then", func() {
+		Eventually(func() error {
+			return k8sClient.Get(ctx, key, &corev1.Service{})
+		}, timeout, interval).Should(Succeed())
+		setServiceIngress(corev1.LoadBalancerIngress{IP: "192.0.2.10"})
+		Eventually(address, timeout, interval).Should(Equal("192.0.2.10"))
+
+		updateWebServer(ctx, key, func(web *webidv1alpha1.WebServer) {
+			web.Spec.Service = &webidv1alpha1.ServiceSpec{Type: corev1.ServiceTypeNodePort, Port: 8081}
+		})
+		Eventually(func() corev1.ServiceType { return service().Spec.Type }, timeout, interval).
+			Should(Equal(corev1.ServiceTypeNodePort))
+		svc := service()
+		Expect(svc.Spec.Ports[0].Port).To(Equal(int32(8081)))
+		Expect(svc.Spec.Ports[0].NodePort).NotTo(BeZero())
+		Expect(svc.Spec.SessionAffinity).To(Equal(corev1.ServiceAffinityNone))
+		Eventually(address, timeout, interval).Should(BeEmpty())
+
+		By("reporting the address of the Ingress")
+		Eventually(func() error {
+			ingress := &netv1.Ingress{}
+			if err := k8sClient.Get(ctx, key, ingress); err != nil {
+				return err
+			}
+			ingress.Status.LoadBalancer.Ingress = []netv1.IngressLoadBalancerIngress{{Hostname: "ingress.example.com"}}
+			return k8sClient.Status().Update(ctx, ingress)
+		}, timeout, interval).Should(Succeed())
+		Eventually(address, timeout, interval).Should(Equal("ingress.example.com"))
+	})
+})
@@ -17,20 +17,30 @@ limitations under the License.
 package controllers
 
 import (
+	"context"
+	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/envtest"
 	logf "sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+	"github.com/tomasji/webid-operator/controllers/config"
+	"github.com/tomasji/webid-operator/controllers/pages"
+	"github.com/tomasji/webid-operator/controllers/webserver"
 	//+kubebuilder:scaffold:imports
 )
 
@@ -40,6 +50,7 @@ import (
 var cfg *rest.Config
 var k8sClient client.Client
 var testEnv *envtest.Environment
+var cancel context.CancelFunc
 
 func TestAPIs(t *testing.T) {
 	RegisterFailHandler(Fail)
@@ -48,11 +59,15 @@ func TestAPIs(t *testing.T) {
 }
 
 var _ = BeforeSuite(func() {
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		Skip("KUBEBUILDER_ASSETS is not set, run the tests by 'make test'")
+	}
 	logf.SetLogger(zap.New(zap.WriteTo(GinkgoWriter), zap.UseDevMode(true)))
 
 	By("bootstrapping test environment")
 	testEnv = &envtest.Environment{
-		CRDDirectoryPaths:     []string{filepath.Join("..", "config", "crd", "bases")},
+		CRDDirectoryPaths: []string{filepath.Join("..", "config", "crd", "bases"),
+			filepath.Join("..", "config", "crd", "test")},
 		ErrorIfCRDPathMissing: true,
 	}
 
@@ -71,10 +86,76 @@ var _ = BeforeSuite(func() {
 	Expect(err).NotTo(HaveOccurred())
 	Expect(k8sClient).NotTo(BeNil())
 
+	By("starting the controllers")
+	mgr, err := ctrl.NewManager(cfg, ctrl.Options{Scheme: scheme.Scheme, MetricsBindAddress: "0"})
+	Expect(err).NotTo(HaveOccurred())
+	controllerCfg := &config.Config{
+		IngressDomain:   "example.com",
+		IngressClass:    "nginx",
+		DataRetention:   3,
+		PageQuietPeriod: 10 * time.Millisecond,
+		PageMaxDelay:    100 * time.Millisecond,
+		Resolver:        "kube-dns.kube-system.svc.cluster.local",
+		ClusterDomain:   "cluster.local",
+	}
+	pageSvc := &pages.Reconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+		Cfg:    controllerCfg,
+		Data:   make(map[types.NamespacedName]pages.PageData),
+		Info:   make(map[types.NamespacedName]pages.PageInfo),
+	}
+	Expect(pageSvc.SetupWithManager(mgr)).To(Succeed())
+	Expect((&webserver.Reconciler{
+		Client:       mgr.GetClient(),
+		Scheme:       mgr.GetScheme(),
+		Cfg:          controllerCfg,
+		DataProvider: pageSvc,
+	}).SetupWithManager(mgr)).To(Succeed())
+
+	var ctx context.Context
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() {
+		defer GinkgoRecover()
+		Expect(mgr.Start(ctx)).To(Succeed())
+	}()
 })
 
 var _ = AfterSuite(func() {
+	if cancel != nil {
+		cancel()
+	}
+	if testEnv == nil {
+		return
+	}
 	By("tearing down the test environment")
 	err := testEnv.Stop()
 	Expect(err).NotTo(HaveOccurred())
 })
+
+// newNamespace creates a namespace for a test (envtest does not delete namespaces, each test uses a new one)
+func newNamespace(ctx context.Context) string {
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{GenerateName: "test-"}}
+	Expect(k8sClient.Create(ctx, ns)).To(Succeed())
+	return ns.Name
+}
+
+// newWebServer returns a WebServer with the required fields set
+func newWebServer(namespace, name string) *webidv1alpha1.WebServer {
+	return &webidv1alpha1.WebServer{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec:       webidv1alpha1.WebServerSpec{Image: "nginx:1.25.3"},
+	}
+}
+
+// updateWebServer changes the spec of the WebServer, it retries on conflicts with the controller
+func updateWebServer(ctx context.Context, key types.NamespacedName, change func(web *webidv1alpha1.WebServer)) {
+	Eventually(func() error {
+		web := &webidv1alpha1.WebServer{}
+		if err := k8sClient.Get(ctx, key, web); err != nil {
+			return err
+		}
+		change(web)
+		return k8sClient.Update(ctx, web)
+	}, 10*time.Second, 100*time.Millisecond).Should(Succeed())
+}
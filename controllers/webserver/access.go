@@ -0,0 +1,223 @@
+package webserver
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+)
+
+// accessSecretKey indexes web servers by the basic auth secrets they reference (see spec.access)
+const accessSecretKey = "spec.access.secrets"
+
+// authSourceAnnotation is set on the htpasswd secret, it is regenerated when the referenced secrets change
+const authSourceAnnotation = "webid.golang.betsys.com/auth-source"
+
+const (
+	authVolName   = "auth"
+	authMountPath = "/etc/nginx/auth"
+	// authServerFile is the htpasswd file of the server-wide rule, files of the path rules are 'path-<index>'
+	authServerFile = "server"
+)
+
+// HtpasswdSecretName returns the name of the secret with htpasswd files of the instance
+func HtpasswdSecretName(base string) string {
+	return base + "-htpasswd"
+}
+
+// authFile returns the htpasswd file name of the path rule (index -1 is the server-wide rule)
+func authFile(index int) string {
+	if index < 0 {
+		return authServerFile
+	}
+	return fmt.Sprintf("path-%d", index)
+}
+
+// accessSecrets returns names of the basic auth secrets referenced by spec.access, indexed by the htpasswd file name
+func accessSecrets(web *webidv1alpha1.WebServer) map[string]string {
+	secrets := make(map[string]string)
+	if web.Spec.Access == nil {
+		return secrets
+	}
+	if ba := web.Spec.Access.BasicAuth; ba != nil {
+		secrets[authFile(-1)] = ba.SecretName
+	}
+	for i, path := range web.Spec.Access.Paths {
+		if path.BasicAuth != nil {
+			secrets[authFile(i)] = path.BasicAuth.SecretName
+		}
+	}
+	return secrets
+}
+
+// validateAccess checks the CIDRs and the basic auth realms of spec.access, nginx would not start with an invalid
+// one (the realm pattern is not validated for objects created by older versions)
+func validateAccess(web *webidv1alpha1.WebServer) error {
+	if web.Spec.Access == nil {
+		return nil
+	}
+	rules := []webidv1alpha1.AccessRule{web.Spec.Access.AccessRule}
+	for _, path := range web.Spec.Access.Paths {
+		rules = append(rules, path.AccessRule)
+	}
+	for _, rule := range rules {
+		if rule.BasicAuth != nil && strings.ContainsAny(rule.BasicAuth.Realm, "\"\\$\r\n") {
+			return fmt.Errorf("invalid basic auth realm '%s' in spec.access", rule.BasicAuth.Realm)
+		}
+		for _, cidr := range append(append([]string{}, rule.Allow...), rule.Deny...) {
+			if _, _, err := net.ParseCIDR(cidr); err != nil && net.ParseIP(cidr) == nil {
+				return fmt.Errorf("invalid address or CIDR '%s' in spec.access", cidr)
+			}
+		}
+	}
+	return nil
+}
+
+// reconcileAccess validates spec.access and creates/updates the secret with htpasswd files rendered from its
+// basic auth secrets. It is created always (empty if basic auth is not used), so that the deployment can mount it.
+func (r *Reconciler) reconcileAccess(ctx context.Context, web *webidv1alpha1.WebServer, inst *instance) (*webidv1alpha1.WebServer, error) {
+	log := log.FromContext(ctx)
+	nsName := types.NamespacedName{Namespace: web.Namespace, Name: HtpasswdSecretName(inst.name)}
+
+	if err := validateAccess(web); err != nil {
+		return r.failWithStatus(ctx, web, err, "Invalid spec.access")
+	}
+
+	// the source of the htpasswd files - names and versions of the referenced secrets
+	files := accessSecrets(web)
+	sources := make(map[string]*corev1.Secret, len(files))
+	sourceKeys := make([]string, 0, len(files))
+	for file, name := range files {
+		src := &corev1.Secret{}
+		if err := r.Get(ctx, types.NamespacedName{Namespace: web.Namespace, Name: name}, src); err != nil {
+			return r.failWithStatus(ctx, web, err, "Failed to get basic auth secret "+name)
+		}
+		sources[file] = src
+		sourceKeys = append(sourceKeys, file+"="+name+"@"+src.ResourceVersion)
+	}
+	sort.Strings(sourceKeys)
+	sum := sha256.Sum256([]byte(strings.Join(sourceKeys, ",")))
+	source := hex.EncodeToString(sum[:])[:16]
+
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, nsName, secret)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return r.failWithStatus(ctx, web, err, "Failed to fetch htpasswd secret")
+	}
+	found := err == nil
+	if found && secret.Annotations[authSourceAnnotation] == source {
+		return web, nil
+	}
+
+	// passwords are hashed with a random salt - the files are regenerated only if the source changes
+	data := make(map[string][]byte, len(sources))
+	for file, src := range sources {
+		if data[file], err = htpasswd(src); err != nil {
+			return r.failWithStatus(ctx, web, err, "Failed to render htpasswd")
+		}
+	}
+
+	if found {
+		secret.Data = data
+		if secret.Annotations == nil {
+			secret.Annotations = make(map[string]string)
+		}
+		secret.Annotations[authSourceAnnotation] = source
+		log.Info("Updating htpasswd Secret", "namespace", secret.Namespace, "name", secret.Name)
+		if err = r.Update(ctx, secret); err != nil {
+			return r.failWithStatus(ctx, web, err, "Failed to update htpasswd secret")
+		}
+		return web, nil
+	}
+
+	secret = &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      nsName.Name,
+			Namespace: nsName.Namespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/name":    inst.name + "-nginx",
+				"app.kubernetes.io/part-of": "webid-operator",
+			},
+			Annotations: map[string]string{authSourceAnnotation: source},
+		},
+		Data: data,
+	}
+	if err = ctrl.SetControllerReference(web, secret, r.Scheme); err != nil {
+		return r.failWithStatus(ctx, web, err, "Failed to create htpasswd secret")
+	}
+	log.Info("Creating a new Secret", "namespace", secret.Namespace, "name", secret.Name)
+	if err = r.Create(ctx, secret); err != nil {
+		return r.failWithStatus(ctx, web, err, "Failed to create htpasswd secret")
+	}
+	return web, nil
+}
+
+// htpasswd renders the users of the secret into a htpasswd file, passwords are hashed as salted SHA-1 ({SSHA})
+func htpasswd(secret *corev1.Secret) ([]byte, error) {
+	users := make(map[string][]byte)
+	if secret.Type == corev1.SecretTypeBasicAuth {
+		users[string(secret.Data[corev1.BasicAuthUsernameKey])] = secret.Data[corev1.BasicAuthPasswordKey]
+	} else {
+		for user, password := range secret.Data {
+			users[user] = password
+		}
+	}
+	names := make([]string, 0, len(users))
+	for user := range users {
+		if user == "" || strings.ContainsAny(user, ":\n") {
+			return nil, fmt.Errorf("invalid user name '%s' in secret %s", user, secret.Name)
+		}
+		names = append(names, user)
+	}
+	sort.Strings(names)
+
+	buf := &strings.Builder{}
+	for _, user := range names {
+		salt := make([]byte, 8)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, err
+		}
+		h := sha1.New()
+		h.Write(users[user])
+		h.Write(salt)
+		fmt.Fprintf(buf, "%s:{SSHA}%s\n", user, base64.StdEncoding.EncodeToString(append(h.Sum(nil), salt...)))
+	}
+	return []byte(buf.String()), nil
+}
+
+// webServersOfAuthSecret maps a Secret to the web servers using it for basic auth (using index)
+func (r *Reconciler) webServersOfAuthSecret(obj client.Object) []reconcile.Request {
+	ctx := context.Background()
+	list := &webidv1alpha1.WebServerList{}
+	opts := []client.ListOption{
+		client.InNamespace(obj.GetNamespace()),
+		client.MatchingFields{accessSecretKey: obj.GetName()},
+	}
+	if err := r.List(ctx, list, opts...); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list webservers", "index", accessSecretKey, "name", obj.GetName())
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(list.Items))
+	for _, web := range list.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: web.Namespace, Name: web.Name}})
+	}
+	return requests
+}
@@ -0,0 +1,170 @@
+package webserver
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+)
+
+// checkSSHA returns true if the htpasswd line holds the password of the user
+func checkSSHA(line, user, password string) bool {
+	if !strings.HasPrefix(line, user+":{SSHA}") {
+		return false
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(line, user+":{SSHA}"))
+	if err != nil || len(raw) <= sha1.Size {
+		return false
+	}
+	h := sha1.New()
+	h.Write([]byte(password))
+	h.Write(raw[sha1.Size:])
+	return string(h.Sum(nil)) == string(raw[:sha1.Size])
+}
+
+var _ = Describe("htpasswd", func() {
+	It("renders the user of a basic-auth secret", func() {
+		secret := &corev1.Secret{Type: corev1.SecretTypeBasicAuth, Data: map[string][]byte{
+			corev1.BasicAuthUsernameKey: []byte("admin"),
+			corev1.BasicAuthPasswordKey: []byte("s3cret"),
+		}}
+		file, err := htpasswd(secret)
+		Expect(err).NotTo(HaveOccurred())
+		lines := strings.Split(strings.TrimSuffix(string(file), "\n"), "\n")
+		Expect(lines).To(HaveLen(1))
+		Expect(checkSSHA(lines[0], "admin", "s3cret")).To(BeTrue())
+		Expect(checkSSHA(lines[0], "admin", "other")).To(BeFalse())
+	})
+
+	It("renders users of an opaque secret sorted, with random salt", func() {
+		secret := &corev1.Secret{Data: map[string][]byte{"bob": []byte("b"), "alice": []byte("a")}}
+		file, err := htpasswd(secret)
+		Expect(err).NotTo(HaveOccurred())
+		lines := strings.Split(strings.TrimSuffix(string(file), "\n"), "\n")
+		Expect(lines).To(HaveLen(2))
+		Expect(checkSSHA(lines[0], "alice", "a")).To(BeTrue())
+		Expect(checkSSHA(lines[1], "bob", "b")).To(BeTrue())
+
+		again, err := htpasswd(secret)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(again).NotTo(Equal(file))
+	})
+
+	DescribeTable("refuses invalid user names",
+		func(secret *corev1.Secret) {
+			_, err := htpasswd(secret)
+			Expect(err).To(HaveOccurred())
+		},
+		Entry("empty basic-auth user", &corev1.Secret{Type: corev1.SecretTypeBasicAuth,
+			Data: map[string][]byte{corev1.BasicAuthPasswordKey: []byte("p")}}),
+		Entry("colon", &corev1.Secret{Data: map[string][]byte{"a:b": []byte("p")}}),
+		Entry("newline", &corev1.Secret{Type: corev1.SecretTypeBasicAuth, Data: map[string][]byte{
+			corev1.BasicAuthUsernameKey: []byte("a\nroot"), corev1.BasicAuthPasswordKey: []byte("p")}}),
+	)
+})
+
+var _ = Describe("validateAccess", func() {
+	access := func(server webidv1alpha1.AccessRule, paths ...webidv1alpha1.AccessRule) *webidv1alpha1.WebServer {
+		spec := &webidv1alpha1.AccessSpec{AccessRule: server}
+		for _, rule := range paths {
+			spec.Paths = append(spec.Paths, webidv1alpha1.PathAccess{Path: "internal-", AccessRule: rule})
+		}
+		return &webidv1alpha1.WebServer{Spec: webidv1alpha1.WebServerSpec{Access: spec}}
+	}
+
+	It("accepts no access rules", func() {
+		Expect(validateAccess(&webidv1alpha1.WebServer{})).To(Succeed())
+	})
+
+	DescribeTable("checks the addresses",
+		func(web *webidv1alpha1.WebServer, valid bool) {
+			if valid {
+				Expect(validateAccess(web)).To(Succeed())
+			} else {
+				Expect(validateAccess(web)).NotTo(Succeed())
+			}
+		},
+		Entry("CIDRs and addresses", access(webidv1alpha1.AccessRule{
+			Allow: []string{"10.0.0.0/8", "192.168.1.1", "fd00::/8"}, Deny: []string{"10.1.0.0/16", "::1"}}), true),
+		Entry("invalid allowed CIDR", access(webidv1alpha1.AccessRule{Allow: []string{"10.0.0.0/33"}}), false),
+		Entry("invalid denied address", access(webidv1alpha1.AccessRule{Deny: []string{"localhost"}}), false),
+		Entry("nginx directive injection", access(webidv1alpha1.AccessRule{Allow: []string{"all; root /"}}), false),
+		Entry("realm", access(webidv1alpha1.AccessRule{
+			BasicAuth: &webidv1alpha1.BasicAuth{SecretName: "users", Realm: "Team docs (internal)"}}), true),
+		Entry("nginx variable in realm", access(webidv1alpha1.AccessRule{
+			BasicAuth: &webidv1alpha1.BasicAuth{SecretName: "users", Realm: "$host"}}), false),
+		Entry("quote in realm", access(webidv1alpha1.AccessRule{
+			BasicAuth: &webidv1alpha1.BasicAuth{SecretName: "users", Realm: `a"; root /`}}), false),
+		Entry("line break in realm of a path", access(webidv1alpha1.AccessRule{},
+			webidv1alpha1.AccessRule{BasicAuth: &webidv1alpha1.BasicAuth{SecretName: "users", Realm: "a\nb"}}), false),
+		Entry("invalid CIDR of a path", access(webidv1alpha1.AccessRule{},
+			webidv1alpha1.AccessRule{Allow: []string{"10.0.0.1"}},
+			webidv1alpha1.AccessRule{Deny: []string{"10.0.0"}}), false),
+	)
+})
+
+var _ = Describe("reconcileAccess", func() {
+	ctx := context.Background()
+
+	It("renders htpasswd files of the rules and regenerates them only when the source changes", func() {
+		users := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "users"},
+			Data: map[string][]byte{"alice": []byte("a")}}
+		web := &webidv1alpha1.WebServer{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web"},
+			Spec: webidv1alpha1.WebServerSpec{Access: &webidv1alpha1.AccessSpec{
+				AccessRule: webidv1alpha1.AccessRule{BasicAuth: &webidv1alpha1.BasicAuth{SecretName: "users"}},
+				Paths: []webidv1alpha1.PathAccess{
+					{Path: "public-"},
+					{Path: "internal-", AccessRule: webidv1alpha1.AccessRule{
+						BasicAuth: &webidv1alpha1.BasicAuth{SecretName: "users"}}},
+				},
+			}},
+		}
+		r := newTestReconciler(web, users)
+		inst := &instance{name: "web"}
+		_, err := r.reconcileAccess(ctx, web, inst)
+		Expect(err).NotTo(HaveOccurred())
+
+		key := types.NamespacedName{Namespace: "ns", Name: HtpasswdSecretName("web")}
+		secret := &corev1.Secret{}
+		Expect(r.Get(ctx, key, secret)).To(Succeed())
+		Expect(secret.Data).To(HaveKey(authFile(-1)))
+		Expect(secret.Data).To(HaveKey(authFile(1)))
+		Expect(secret.Data).NotTo(HaveKey(authFile(0)))
+		Expect(metav1.IsControlledBy(secret, web)).To(BeTrue())
+		first := secret.Data[authFile(-1)]
+
+		_, err = r.reconcileAccess(ctx, web, inst)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Get(ctx, key, secret)).To(Succeed())
+		Expect(secret.Data[authFile(-1)]).To(Equal(first))
+
+		users.Data["bob"] = []byte("b")
+		Expect(r.Update(ctx, users)).To(Succeed())
+		_, err = r.reconcileAccess(ctx, web, inst)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Get(ctx, key, secret)).To(Succeed())
+		Expect(string(secret.Data[authFile(-1)])).To(ContainSubstring("bob:{SSHA}"))
+	})
+
+	It("fails on a missing basic auth secret", func() {
+		web := &webidv1alpha1.WebServer{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web"},
+			Spec: webidv1alpha1.WebServerSpec{Access: &webidv1alpha1.AccessSpec{
+				AccessRule: webidv1alpha1.AccessRule{BasicAuth: &webidv1alpha1.BasicAuth{SecretName: "users"}},
+			}},
+		}
+		r := newTestReconciler(web)
+		_, err := r.reconcileAccess(ctx, web, &instance{name: "web"})
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,122 @@
+package webserver
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+	"github.com/tomasji/webid-operator/controllers/pages"
+)
+
+// authHashAnnotation is set on the pod template, so that the auth proxy sidecar is updated when spec.auth changes
+const authHashAnnotation = "webid.golang.betsys.com/auth-hash"
+
+const (
+	authContainerName = "oauth2-proxy"
+	// authPort is the name of the auth proxy port, the service is routed to it if the auth proxy is enabled
+	authPort         = "auth"
+	authPortNumber   = 4180
+	defaultOIDCImage = "quay.io/oauth2-proxy/oauth2-proxy:v7.4.0"
+)
+
+// oidcSpec returns spec.auth.oidc of the web server, nil if the auth proxy is not enabled
+func oidcSpec(web *webidv1alpha1.WebServer) *webidv1alpha1.OIDCSpec {
+	if web.Spec.Auth == nil {
+		return nil
+	}
+	return web.Spec.Auth.OIDC
+}
+
+// targetPort returns the container port the service is routed to - the auth proxy if it is enabled, nginx otherwise
+func targetPort(web *webidv1alpha1.WebServer) intstr.IntOrString {
+	if oidcSpec(web) != nil {
+		return intstr.FromString(authPort)
+	}
+	return intstr.FromString(httpPort)
+}
+
+// nginxPorts returns the ports of the nginx container, none if the auth proxy is enabled - nginx listens
+// on the loopback only then, so that the proxy cannot be bypassed
+func nginxPorts(web *webidv1alpha1.WebServer) []corev1.ContainerPort {
+	if oidcSpec(web) != nil {
+		return nil
+	}
+	return []corev1.ContainerPort{{ContainerPort: 80, Name: httpPort}}
+}
+
+// nginxListen returns the addresses nginx listens on, the loopback only if the auth proxy is enabled
+func nginxListen(web *webidv1alpha1.WebServer) []string {
+	if oidcSpec(web) != nil {
+		return []string{"127.0.0.1:80"}
+	}
+	return []string{"80", "[::]:80"}
+}
+
+// authContainers returns the auth proxy sidecar containers of the deployment, none if it is not enabled
+func authContainers(web *webidv1alpha1.WebServer) []corev1.Container {
+	oidc := oidcSpec(web)
+	if oidc == nil {
+		return nil
+	}
+	image := oidc.Image
+	if image == "" {
+		image = defaultOIDCImage
+	}
+	args := []string{
+		"--provider=oidc",
+		"--oidc-issuer-url=" + oidc.IssuerURL,
+		"--http-address=0.0.0.0:4180",
+		"--upstream=http://127.0.0.1:80/",
+		"--proxy-prefix=" + strings.TrimSuffix(pages.PathPrefix(web), "/") + "/oauth2",
+		"--email-domain=*",
+		"--reverse-proxy=true",
+		"--skip-provider-button=true",
+	}
+	for _, group := range oidc.AllowedGroups {
+		args = append(args, "--allowed-group="+group)
+	}
+	env := func(name, key string) corev1.EnvVar {
+		return corev1.EnvVar{Name: name, ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: oidc.ClientSecretName},
+			Key:                  key,
+		}}}
+	}
+
+	return []corev1.Container{{
+		Name:            authContainerName,
+		Image:           image,
+		ImagePullPolicy: corev1.PullIfNotPresent,
+		Args:            args,
+		Env: []corev1.EnvVar{
+			env("OAUTH2_PROXY_CLIENT_ID", "client-id"),
+			env("OAUTH2_PROXY_CLIENT_SECRET", "client-secret"),
+			env("OAUTH2_PROXY_COOKIE_SECRET", "cookie-secret"),
+		},
+		Ports: []corev1.ContainerPort{{
+			ContainerPort: authPortNumber,
+			Name:          authPort,
+		}},
+		ReadinessProbe: &corev1.Probe{
+			ProbeHandler: corev1.ProbeHandler{HTTPGet: &corev1.HTTPGetAction{Path: "/ping", Port: intstr.FromString(authPort)}},
+		},
+	}}
+}
+
+// authHash returns a short hash of the auth proxy sidecar, empty if it is not enabled
+func authHash(web *webidv1alpha1.WebServer) string {
+	containers := authContainers(web)
+	if containers == nil {
+		return ""
+	}
+	b, err := json.Marshal(containers)
+	if err != nil {
+		panic(err) // the containers are always serializable
+	}
+	h := sha1.Sum(b)
+	return hex.EncodeToString(h[:])[:16]
+}
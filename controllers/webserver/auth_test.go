@@ -0,0 +1,121 @@
+package webserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+)
+
+var _ = Describe("OIDC auth proxy", func() {
+	var (
+		ctx    context.Context
+		issuer *httptest.Server
+		web    *webidv1alpha1.WebServer
+		inst   *instance
+	)
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		// stub issuer, serving the discovery document oauth2-proxy starts with
+		mux := http.NewServeMux()
+		mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, req *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(map[string]string{
+				"issuer":                 issuer.URL,
+				"authorization_endpoint": issuer.URL + "/auth",
+				"token_endpoint":         issuer.URL + "/token",
+				"jwks_uri":               issuer.URL + "/keys",
+			})
+		})
+		issuer = httptest.NewServer(mux)
+		DeferCleanup(issuer.Close)
+
+		web = &webidv1alpha1.WebServer{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web"},
+			Spec: webidv1alpha1.WebServerSpec{Image: "nginx", Replicas: 1, PathPrefix: "/docs/",
+				Auth: &webidv1alpha1.AuthSpec{OIDC: &webidv1alpha1.OIDCSpec{
+					IssuerURL: issuer.URL, ClientSecretName: "oidc", AllowedGroups: []string{"devs"}}}},
+		}
+		inst = &instance{name: "web", dataCM: "web-data"}
+	})
+
+	// arg returns the value of the sidecar argument
+	arg := func(container corev1.Container, name string) string {
+		for _, a := range container.Args {
+			if strings.HasPrefix(a, "--"+name+"=") {
+				return strings.TrimPrefix(a, "--"+name+"=")
+			}
+		}
+		return ""
+	}
+
+	It("configures the sidecar with the issuer, the loopback upstream and the client secret", func() {
+		containers := authContainers(web)
+		Expect(containers).To(HaveLen(1))
+		proxy := containers[0]
+		Expect(proxy.Image).To(Equal(defaultOIDCImage))
+		Expect(arg(proxy, "upstream")).To(Equal("http://127.0.0.1:80/"))
+		Expect(arg(proxy, "proxy-prefix")).To(Equal("/docs/oauth2"))
+		Expect(arg(proxy, "allowed-group")).To(Equal("devs"))
+		for _, env := range proxy.Env {
+			Expect(env.ValueFrom.SecretKeyRef.Name).To(Equal("oidc"))
+		}
+		Expect(proxy.Ports).To(Equal([]corev1.ContainerPort{{ContainerPort: authPortNumber, Name: authPort}}))
+
+		resp, err := http.Get(arg(proxy, "oidc-issuer-url") + "/.well-known/openid-configuration")
+		Expect(err).NotTo(HaveOccurred())
+		defer resp.Body.Close()
+		discovery := map[string]string{}
+		Expect(json.NewDecoder(resp.Body).Decode(&discovery)).To(Succeed())
+		Expect(discovery["issuer"]).To(Equal(issuer.URL))
+	})
+
+	It("routes the Service to the sidecar", func() {
+		ports := servicePorts(web, serviceSpec(web))
+		Expect(ports).To(HaveLen(1))
+		Expect(ports[0].Name).To(Equal(httpPort))
+		Expect(ports[0].TargetPort).To(Equal(intstr.FromString(authPort)))
+	})
+
+	It("does not expose nginx beside the sidecar", func() {
+		config := string(nginxConfig(web, inst, testConfig()))
+		Expect(config).To(ContainSubstring("listen  127.0.0.1:80;"))
+		Expect(strings.Count(config, "listen ")).To(Equal(1))
+
+		r := newTestReconciler(web)
+		_, err := r.reconcileDeployment(ctx, web, inst)
+		Expect(err).NotTo(HaveOccurred())
+		deployment := &appsv1.Deployment{}
+		Expect(r.Get(ctx, types.NamespacedName{Namespace: "ns", Name: "web"}, deployment)).To(Succeed())
+		var ports []corev1.ContainerPort
+		for _, container := range deployment.Spec.Template.Spec.Containers {
+			ports = append(ports, container.Ports...)
+		}
+		Expect(ports).To(Equal([]corev1.ContainerPort{{ContainerPort: authPortNumber, Name: authPort}}))
+
+		By("disabling the auth proxy, nginx is exposed again")
+		web.Spec.Auth = nil
+		_, err = r.reconcileDeployment(ctx, web, inst)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Get(ctx, types.NamespacedName{Namespace: "ns", Name: "web"}, deployment)).To(Succeed())
+		Expect(deployment.Spec.Template.Spec.Containers).To(HaveLen(1))
+		Expect(deployment.Spec.Template.Spec.Containers[0].Ports).To(Equal(
+			[]corev1.ContainerPort{{ContainerPort: 80, Name: httpPort}}))
+		config = string(nginxConfig(web, inst, testConfig()))
+		Expect(config).To(ContainSubstring("listen  80;"))
+		Expect(config).To(ContainSubstring("listen  [::]:80;"))
+	})
+})
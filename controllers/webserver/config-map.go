@@ -2,7 +2,9 @@ package webserver
 
 import (
 	"context"
+	"sort"
 
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
 
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
@@ -10,9 +12,11 @@ import (
 	"k8s.io/apimachinery/pkg/types"
 
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+	"github.com/tomasji/webid-operator/controllers/pages"
 )
 
 type CMType string
@@ -24,16 +28,26 @@ const (
 	dataDir           = "/var/www"
 )
 
+// dataOfLabel is set on data configMaps, value is the name of the instance (deployment) the data are for
+const dataOfLabel = "webid.golang.betsys.com/data-of"
+
 func ConfigCMName(base string) string { return base + "-" + (string(typeConfig)) }
-func DataCMName(base string) string   { return base + "-" + (string(typeData)) }
+
+// DataCMName returns the name of the data configMap, named after the hash of its contents
+func DataCMName(base, hash string) string { return base + "-" + (string(typeData)) + "-" + hash[:10] }
 
 // reconcileConfigCM gets the configMap with nginx configuration
 // - if not found, create it
-func (r *Reconciler) reconcileConfigCM(ctx context.Context, web *webidv1alpha1.WebServer) (*webidv1alpha1.WebServer, error) {
+// - if not up to date, update it
+func (r *Reconciler) reconcileConfigCM(ctx context.Context, web *webidv1alpha1.WebServer, inst *instance) (*webidv1alpha1.WebServer, error) {
 	debug := log.FromContext(ctx).V(1).Info
-	cmName := ConfigCMName(web.Name)
+	cmName := ConfigCMName(inst.name)
 	nsName := types.NamespacedName{Namespace: web.Namespace, Name: cmName}
 
+	if err := validateSecurityHeaders(web); err != nil {
+		return r.failWithStatus(ctx, web, err, "Invalid spec.securityHeaders")
+	}
+
 	// Get the config configMap
 	debug("checking configMap", "name", cmName)
 	configMap := &corev1.ConfigMap{}
@@ -44,23 +58,37 @@ func (r *Reconciler) reconcileConfigCM(ctx context.Context, web *webidv1alpha1.W
 		}
 
 		// configMap not found - create it
-		if err = r.createConfigCM(ctx, web); err != nil {
+		if err = r.createConfigCM(ctx, web, inst); err != nil {
 			return r.failWithStatus(ctx, web, err, "Failed to create configMap")
 		}
 		return web, nil
 	}
 
-	// configMap found - static CM should not be updated
+	// configMap found - check it and update it if needed
+	data := r.configData(web, inst)
+	if r.configMapDiffers(configMap, data) {
+		if err := r.updateConfigMap(ctx, configMap, data); err != nil {
+			return r.failWithStatus(ctx, web, err, "Failed to update configMap")
+		}
+	}
 	debug("configMap is ok", "name", cmName)
 	return web, nil
 }
 
-// reconcileDataCM gets the configMap with nginx web pages
-// - if not found, create it
-// - if not up to date, update it
-func (r *Reconciler) reconcileDataCM(ctx context.Context, web *webidv1alpha1.WebServer) (*webidv1alpha1.WebServer, error) {
+// reconcileDataCM gets the configMap with nginx web pages, the configMap is immutable and named after
+// the hash of its contents, so a content change creates a new configMap (the deployment is rolled out then)
+// - if not found, create it (not for an instance pinned to a release, it mounts the release configMap)
+// - delete old configMaps over the retention limit
+func (r *Reconciler) reconcileDataCM(ctx context.Context, web *webidv1alpha1.WebServer, inst *instance) (*webidv1alpha1.WebServer, error) {
 	debug := log.FromContext(ctx).V(1).Info
-	cmName := DataCMName(web.Name)
+	if inst.release != "" {
+		debug("serving release, no data configMap", "release", inst.release)
+		if err := r.deleteOldDataCMs(ctx, web, inst); err != nil {
+			return r.failWithStatus(ctx, web, err, "Failed to delete old configMaps")
+		}
+		return web, nil
+	}
+	cmName := DataCMName(inst.name, pages.Hash(inst.contents, inst.info))
 	nsName := types.NamespacedName{Namespace: web.Namespace, Name: cmName}
 
 	// Get the data configMap
@@ -73,37 +101,107 @@ func (r *Reconciler) reconcileDataCM(ctx context.Context, web *webidv1alpha1.Web
 		}
 
 		// configMap not found - create it
-		if err = r.createDataCM(ctx, web); err != nil {
+		if err = r.createDataCM(ctx, web, inst, cmName); err != nil {
 			return r.failWithStatus(ctx, web, err, "Failed to create configMap")
 		}
-		return web, nil
+	} else {
+		debug("configMap is ok", "name", cmName)
 	}
 
-	// configMap found - check it and update it if needed
-	data := r.DataProvider.GetData(types.NamespacedName{Namespace: web.Namespace, Name: web.Name})
-	if r.configMapDiffers(configMap, data) {
-		if err := r.updateConfigMap(ctx, configMap, data); err != nil {
-			return r.failWithStatus(ctx, web, err, "Failed to update configMap")
-		}
+	if err := r.deleteOldDataCMs(ctx, web, inst); err != nil {
+		return r.failWithStatus(ctx, web, err, "Failed to delete old configMaps")
 	}
-	debug("configMap is ok", "name", cmName)
 	return web, nil
 }
 
+// deleteOldDataCMs deletes data configMaps of the instance (controlled by web), except the current one,
+// the ones mounted by the deployment or its ReplicaSets still running pods and Cfg.DataRetention newest ones
+func (r *Reconciler) deleteOldDataCMs(ctx context.Context, web *webidv1alpha1.WebServer, inst *instance) error {
+	log := log.FromContext(ctx)
+
+	mounted, err := r.mountedDataCMs(ctx, web, inst)
+	if err != nil {
+		return err
+	}
+	list := &corev1.ConfigMapList{}
+	if err := r.List(ctx, list, client.InNamespace(web.Namespace), client.MatchingLabels{dataOfLabel: inst.name}); err != nil {
+		return err
+	}
+	sort.Slice(list.Items, func(i, j int) bool {
+		ti, tj := list.Items[i].CreationTimestamp, list.Items[j].CreationTimestamp
+		return tj.Before(&ti)
+	})
+
+	kept := 0
+	for i := range list.Items {
+		configMap := &list.Items[i]
+		if configMap.Name == inst.dataCM || mounted[configMap.Name] || !metav1.IsControlledBy(configMap, web) {
+			continue
+		}
+		if kept < r.Cfg.DataRetention {
+			kept++
+			continue
+		}
+		log.Info("deleting old config map", "name", configMap.Name)
+		if err := r.Delete(ctx, configMap); err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// mountedDataCMs returns the names of data configMaps mounted by the deployment of the instance and by its
+// ReplicaSets with pods (the old ReplicaSet keeps serving the old data until a rollout is finished)
+func (r *Reconciler) mountedDataCMs(ctx context.Context, web *webidv1alpha1.WebServer, inst *instance) (map[string]bool, error) {
+	mounted := make(map[string]bool)
+	deployment := &appsv1.Deployment{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: web.Namespace, Name: inst.name}, deployment); err != nil {
+		if apierrors.IsNotFound(err) {
+			return mounted, nil
+		}
+		return nil, err
+	}
+	if name := dataCMOf(&deployment.Spec.Template); name != "" {
+		mounted[name] = true
+	}
+
+	list := &appsv1.ReplicaSetList{}
+	if err := r.List(ctx, list, client.InNamespace(web.Namespace)); err != nil {
+		return nil, err
+	}
+	for i := range list.Items {
+		rs := &list.Items[i]
+		if !metav1.IsControlledBy(rs, deployment) || (rs.Status.Replicas == 0 && (rs.Spec.Replicas == nil || *rs.Spec.Replicas == 0)) {
+			continue
+		}
+		if name := dataCMOf(&rs.Spec.Template); name != "" {
+			mounted[name] = true
+		}
+	}
+	return mounted, nil
+}
+
 // createConfigCM creates a configMap with nginx config, set ownership to web
-func (r *Reconciler) createConfigCM(ctx context.Context, web *webidv1alpha1.WebServer) error {
-	return r.createConfigMap(ctx, web, ConfigCMName(web.Name), map[string][]byte{fileConfig: []byte(nginxConfigData)})
+func (r *Reconciler) createConfigCM(ctx context.Context, web *webidv1alpha1.WebServer, inst *instance) error {
+	return r.createConfigMap(ctx, web, ConfigCMName(inst.name), r.configData(web, inst))
+}
+
+// configData returns the items of the configMap with nginx config
+func (r *Reconciler) configData(web *webidv1alpha1.WebServer, inst *instance) map[string][]byte {
+	return map[string][]byte{fileConfig: nginxConfig(web, inst, r.Cfg)}
 }
 
-// createDataCM creates a configMap with nginx data/web pages, set ownership to web
-func (r *Reconciler) createDataCM(ctx context.Context, web *webidv1alpha1.WebServer) error {
-	data := r.DataProvider.GetData(types.NamespacedName{Namespace: web.Namespace, Name: web.Name})
-	return r.createConfigMap(ctx, web, DataCMName(web.Name), data)
+// createDataCM creates an immutable configMap with nginx data/web pages, set ownership to web
+func (r *Reconciler) createDataCM(ctx context.Context, web *webidv1alpha1.WebServer, inst *instance, name string) error {
+	return r.createConfigMap(ctx, web, name, inst.contents, func(configMap *corev1.ConfigMap) {
+		configMap.Labels[dataOfLabel] = inst.name
+		configMap.Immutable = ptr(true)
+	})
 }
 
-// createConfigMap creates a configMap, set ownership to web
+// createConfigMap creates a configMap, set ownership to web, the optional mutate functions adjust it before creation
 func (r *Reconciler) createConfigMap(ctx context.Context, web *webidv1alpha1.WebServer,
-	name string, items map[string][]byte,
+	name string, items map[string][]byte, mutate ...func(*corev1.ConfigMap),
 ) error {
 	log := log.FromContext(ctx)
 	labels := map[string]string{
@@ -119,6 +217,9 @@ func (r *Reconciler) createConfigMap(ctx context.Context, web *webidv1alpha1.Web
 		},
 		BinaryData: items,
 	}
+	for _, m := range mutate {
+		m(configMap)
+	}
 
 	// Set the ownerRef for the ConfigMap
 	// More info: https://kubernetes.io/docs/concepts/overview/working-with-objects/owners-dependents/
@@ -136,12 +237,12 @@ func (r *Reconciler) createConfigMap(ctx context.Context, web *webidv1alpha1.Web
 	return nil
 }
 
-// configMapDiffers returns true if docker image or number of replicas are different than expected
+// configMapDiffers returns true if the items of the configMap are different than expected
 func (r *Reconciler) configMapDiffers(configMap *corev1.ConfigMap, data map[string][]byte) bool {
 	return r.DataProvider.DataDiffer(configMap.BinaryData, data)
 }
 
-// updateConfigMap updates image and/or replicas of the configMap
+// updateConfigMap updates the items of the configMap
 func (r *Reconciler) updateConfigMap(ctx context.Context, configMap *corev1.ConfigMap, data map[string][]byte) error {
 	log := log.FromContext(ctx)
 
@@ -154,26 +255,3 @@ func (r *Reconciler) updateConfigMap(ctx context.Context, configMap *corev1.Conf
 	log.V(1).Info("config map updated", "name", configMap.Name)
 	return nil
 }
-
-const nginxConfigData = `
-server {
-    listen       80;
-    listen  [::]:80;
-    server_name  localhost;
-
-    location / {
-        root   /var/www;
-        autoindex on;
-        autoindex_exact_size off;
-        autoindex_format html;
-        autoindex_localtime on;
-        default_type text/html;
-        index  index.html index.htm;
-    }
-
-    error_page   500 502 503 504  /50x.html;
-    location = /50x.html {
-        root   /usr/share/nginx/html;
-    }
-}
-`
@@ -0,0 +1,79 @@
+package webserver
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+)
+
+var _ = Describe("deleteOldDataCMs", func() {
+	var (
+		r    *Reconciler
+		web  *webidv1alpha1.WebServer
+		inst *instance
+	)
+
+	dataCM := func(owner *webidv1alpha1.WebServer, hash string) *corev1.ConfigMap {
+		cm := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: DataCMName("foo", hash), Namespace: "ns",
+			Labels: map[string]string{dataOfLabel: "foo"}}}
+		Expect(ctrl.SetControllerReference(owner, cm, testScheme())).To(Succeed())
+		return cm
+	}
+	template := func(cm string) corev1.PodTemplateSpec {
+		return corev1.PodTemplateSpec{Spec: corev1.PodSpec{Volumes: []corev1.Volume{{Name: dataVolName,
+			VolumeSource: corev1.VolumeSource{ConfigMap: &corev1.ConfigMapVolumeSource{
+				LocalObjectReference: corev1.LocalObjectReference{Name: cm}}}}}}}
+	}
+	replicaSet := func(deployment *appsv1.Deployment, name, cm string, replicas int32) *appsv1.ReplicaSet {
+		rs := &appsv1.ReplicaSet{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns"},
+			Spec: appsv1.ReplicaSetSpec{Replicas: ptr(replicas), Template: template(cm)}}
+		Expect(ctrl.SetControllerReference(deployment, rs, testScheme())).To(Succeed())
+		return rs
+	}
+	names := func() []string {
+		list := &corev1.ConfigMapList{}
+		Expect(r.List(context.Background(), list, client.MatchingLabels{dataOfLabel: "foo"})).To(Succeed())
+		var names []string
+		for _, cm := range list.Items {
+			names = append(names, cm.Name)
+		}
+		return names
+	}
+
+	BeforeEach(func() {
+		web = &webidv1alpha1.WebServer{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "foo", UID: "foo-uid"}}
+		inst = &instance{name: "foo", dataCM: DataCMName("foo", "currentcurrent")}
+	})
+
+	It("keeps the data mounted by running pods during a rollout", func() {
+		other := &webidv1alpha1.WebServer{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "other", UID: "other-uid"}}
+		deployment := &appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: "foo", Namespace: "ns", UID: "deploy-uid"},
+			Spec: appsv1.DeploymentSpec{Template: template(inst.dataCM)}}
+		r = newTestReconciler(web, deployment,
+			dataCM(web, "currentcurrent"), dataCM(web, "rolloutrollout"), dataCM(web, "stale0stale"), dataCM(other, "foreignforeign"),
+			replicaSet(deployment, "foo-new", inst.dataCM, 1),
+			replicaSet(deployment, "foo-old", DataCMName("foo", "rolloutrollout"), 1),
+			replicaSet(deployment, "foo-older", DataCMName("foo", "stale0stale"), 0))
+
+		Expect(r.deleteOldDataCMs(context.Background(), web, inst)).To(Succeed())
+		Expect(names()).To(ConsistOf(inst.dataCM, DataCMName("foo", "rolloutrollout"), DataCMName("foo", "foreignforeign")))
+	})
+
+	It("keeps Cfg.DataRetention old configMaps", func() {
+		r = newTestReconciler(web, dataCM(web, "currentcurrent"), dataCM(web, "stale0stale"), dataCM(web, "stale1stale"))
+		r.Cfg.DataRetention = 1
+
+		Expect(r.deleteOldDataCMs(context.Background(), web, inst)).To(Succeed())
+		Expect(names()).To(HaveLen(2))
+		Expect(names()).To(ContainElement(inst.dataCM))
+	})
+})
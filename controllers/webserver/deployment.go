@@ -17,15 +17,25 @@ import (
 	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
 )
 
-// reconcileDeployment gets the deployment (NS+name is same as of the web resource)
+// configHashAnnotation is set on the pod template, so that pods are rolled out when nginx config changes
+const configHashAnnotation = "webid.golang.betsys.com/config-hash"
+
+const (
+	configVolName   = "config"
+	configMountPath = "/etc/nginx/conf.d"
+	dataVolName     = "data"
+	dataMountPath   = "/var/www"
+)
+
+// reconcileDeployment gets the deployment (NS is same as of the web resource, name is the instance name)
 // - if not found, create it
 // - if found, compare it with the required status, update if necessary
-func (r *Reconciler) reconcileDeployment(ctx context.Context, web *webidv1alpha1.WebServer) (*webidv1alpha1.WebServer, error) {
+func (r *Reconciler) reconcileDeployment(ctx context.Context, web *webidv1alpha1.WebServer, inst *instance) (*webidv1alpha1.WebServer, error) {
 	debug := log.FromContext(ctx).V(1).Info
-	nsName := types.NamespacedName{Namespace: web.Namespace, Name: web.Name}
+	nsName := types.NamespacedName{Namespace: web.Namespace, Name: inst.name}
 
 	// Get the deployment
-	debug("checking deployment", "name", web.Name)
+	debug("checking deployment", "name", inst.name)
 	deployment := &appsv1.Deployment{}
 	if err := r.Get(ctx, nsName, deployment); err != nil {
 		// generic error
@@ -34,20 +44,20 @@ func (r *Reconciler) reconcileDeployment(ctx context.Context, web *webidv1alpha1
 		}
 
 		// deployment not found - create it
-		if err = r.createDeployment(ctx, web); err != nil {
+		if err = r.createDeployment(ctx, web, inst); err != nil {
 			return r.failWithStatus(ctx, web, err, "Failed to create deployment")
 		}
 		return web, nil
 	}
 
 	// deployment found - check it and update it if needed
-	debug("deployment found", "name", web.Name)
-	if r.deploymentDiffers(web, deployment) {
-		if err := r.updateDeployment(ctx, web, deployment); err != nil {
+	debug("deployment found", "name", inst.name)
+	if r.deploymentDiffers(web, inst, deployment) {
+		if err := r.updateDeployment(ctx, web, inst, deployment); err != nil {
 			return r.failWithStatus(ctx, web, err, "Failed to update deployment")
 		}
 	} else {
-		debug("deployment is ok", "name", web.Name)
+		debug("deployment is ok", "name", inst.name)
 	}
 	return web, nil
 }
@@ -60,20 +70,13 @@ func (r *Reconciler) selectorLabels(appName string) map[string]string {
 }
 
 // createDeployment creates a deployment, set ownership to web
-func (r *Reconciler) createDeployment(ctx context.Context, web *webidv1alpha1.WebServer) error {
-	const (
-		configVolName   = "config"
-		configMountPath = "/etc/nginx/conf.d"
-		dataVolName     = "data"
-		dataMountPath   = "/var/www"
-	)
-
+func (r *Reconciler) createDeployment(ctx context.Context, web *webidv1alpha1.WebServer, inst *instance) error {
 	log := log.FromContext(ctx)
-	labels := r.selectorLabels(web.Name)
+	labels := r.selectorLabels(inst.name)
 
 	deployment := &appsv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      web.Name,
+			Name:      inst.name,
 			Namespace: web.Namespace,
 			Labels:    labels,
 		},
@@ -84,17 +87,15 @@ func (r *Reconciler) createDeployment(ctx context.Context, web *webidv1alpha1.We
 			},
 			Template: corev1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
-					Labels: labels,
+					Labels:      labels,
+					Annotations: podAnnotations(r.configHash(web, inst), authHash(web)),
 				},
 				Spec: corev1.PodSpec{
-					Containers: []corev1.Container{{
+					Containers: append([]corev1.Container{{
 						Image:           web.Spec.Image,
 						Name:            "main",
 						ImagePullPolicy: corev1.PullIfNotPresent,
-						Ports: []corev1.ContainerPort{{
-							ContainerPort: 80,
-							Name:          "http",
-						}},
+						Ports:           nginxPorts(web),
 						VolumeMounts: []corev1.VolumeMount{
 							{
 								Name:      configVolName,
@@ -106,15 +107,16 @@ func (r *Reconciler) createDeployment(ctx context.Context, web *webidv1alpha1.We
 								ReadOnly:  true,
 								MountPath: dataMountPath,
 							},
+							authVolumeMount(),
 						},
-					}},
+					}}, authContainers(web)...),
 					Volumes: []corev1.Volume{
 						{
 							Name: configVolName,
 							VolumeSource: corev1.VolumeSource{
 								ConfigMap: &corev1.ConfigMapVolumeSource{
 									LocalObjectReference: corev1.LocalObjectReference{
-										Name: ConfigCMName(web.Name),
+										Name: ConfigCMName(inst.name),
 									},
 								},
 							},
@@ -124,11 +126,12 @@ func (r *Reconciler) createDeployment(ctx context.Context, web *webidv1alpha1.We
 							VolumeSource: corev1.VolumeSource{
 								ConfigMap: &corev1.ConfigMapVolumeSource{
 									LocalObjectReference: corev1.LocalObjectReference{
-										Name: DataCMName(web.Name),
+										Name: inst.dataCM,
 									},
 								},
 							},
 						},
+						authVolume(inst),
 					},
 				},
 			},
@@ -150,29 +153,124 @@ func (r *Reconciler) createDeployment(ctx context.Context, web *webidv1alpha1.We
 	return nil
 }
 
-// deploymentDiffers returns true if docker image or number of replicas are different than expected
-func (r *Reconciler) deploymentDiffers(web *webidv1alpha1.WebServer, deployment *appsv1.Deployment) bool {
-	if len(deployment.Spec.Template.Spec.Containers) != 1 {
+// configHash returns the hash of the nginx config of the web instance
+func (r *Reconciler) configHash(web *webidv1alpha1.WebServer, inst *instance) string {
+	return configHash(r.configData(web, inst)[fileConfig])
+}
+
+// dataVolume returns the volume of the deployment with pages data
+func dataVolume(deployment *appsv1.Deployment) *corev1.Volume {
+	return templateDataVolume(&deployment.Spec.Template)
+}
+
+// templateDataVolume returns the volume of the pod template with pages data
+func templateDataVolume(template *corev1.PodTemplateSpec) *corev1.Volume {
+	for i, vol := range template.Spec.Volumes {
+		if vol.Name == dataVolName && vol.ConfigMap != nil {
+			return &template.Spec.Volumes[i]
+		}
+	}
+	return nil
+}
+
+// dataCMOf returns the name of the data configMap mounted by the pod template, empty if none
+func dataCMOf(template *corev1.PodTemplateSpec) string {
+	if vol := templateDataVolume(template); vol != nil {
+		return vol.ConfigMap.Name
+	}
+	return ""
+}
+
+// hasAuthVolume returns true if the deployment mounts the htpasswd secret
+func hasAuthVolume(deployment *appsv1.Deployment) bool {
+	for _, vol := range deployment.Spec.Template.Spec.Volumes {
+		if vol.Name == authVolName {
+			return true
+		}
+	}
+	return false
+}
+
+// authVolume returns the volume with the htpasswd secret of the instance
+func authVolume(inst *instance) corev1.Volume {
+	return corev1.Volume{
+		Name: authVolName,
+		VolumeSource: corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{SecretName: HtpasswdSecretName(inst.name)},
+		},
+	}
+}
+
+// authVolumeMount returns the mount of the htpasswd secret volume
+func authVolumeMount() corev1.VolumeMount {
+	return corev1.VolumeMount{Name: authVolName, ReadOnly: true, MountPath: authMountPath}
+}
+
+// podAnnotations returns annotations of the pod template, the auth hash is set only if the auth proxy is enabled
+func podAnnotations(configHash, authHash string) map[string]string {
+	annotations := map[string]string{configHashAnnotation: configHash}
+	if authHash != "" {
+		annotations[authHashAnnotation] = authHash
+	}
+	return annotations
+}
+
+// deploymentDiffers returns true if docker image, number of replicas, nginx config, mounted data,
+// the htpasswd volume or the auth proxy sidecar are different than expected
+func (r *Reconciler) deploymentDiffers(web *webidv1alpha1.WebServer, inst *instance, deployment *appsv1.Deployment) bool {
+	if len(deployment.Spec.Template.Spec.Containers) != 1+len(authContainers(web)) ||
+		deployment.Spec.Template.Annotations[authHashAnnotation] != authHash(web) {
 		return true
 	}
+	vol := dataVolume(deployment)
 	return web.Spec.Image != deployment.Spec.Template.Spec.Containers[0].Image ||
-		web.Spec.Replicas != *deployment.Spec.Replicas
+		web.Spec.Replicas != *deployment.Spec.Replicas ||
+		r.configHash(web, inst) != deployment.Spec.Template.Annotations[configHashAnnotation] ||
+		vol == nil || vol.ConfigMap.Name != inst.dataCM || !hasAuthVolume(deployment)
 }
 
-// updateDeployment updates image and/or replicas of the deployment
-func (r *Reconciler) updateDeployment(ctx context.Context, web *webidv1alpha1.WebServer, deployment *appsv1.Deployment) error {
+// updateDeployment updates image, replicas, config hash, mounted data and/or auth proxy sidecar of the deployment
+func (r *Reconciler) updateDeployment(ctx context.Context, web *webidv1alpha1.WebServer, inst *instance, deployment *appsv1.Deployment) error {
 	log := log.FromContext(ctx)
 
-	log.Info("updating deployment", "name", web.Name)
-	if len(deployment.Spec.Template.Spec.Containers) != 1 { // should never happen
+	log.Info("updating deployment", "name", inst.name)
+	if len(deployment.Spec.Template.Spec.Containers) == 0 { // should never happen
 		if delErr := r.Delete(ctx, deployment); delErr != nil {
 			log.Error(delErr, "deleting deployment")
 		}
-		return fmt.Errorf("deployment '%s' has %d containers (expected 1)", deployment.Name, len(deployment.Spec.Template.Spec.Containers))
+		return fmt.Errorf("deployment '%s' has no containers", deployment.Name)
 	}
+	deployment.Spec.Template.Spec.Containers = append(deployment.Spec.Template.Spec.Containers[:1], authContainers(web)...)
 
 	deployment.Spec.Template.Spec.Containers[0].Image = web.Spec.Image
+	deployment.Spec.Template.Spec.Containers[0].Ports = nginxPorts(web)
 	deployment.Spec.Replicas = ptr(web.Spec.Replicas)
+	if deployment.Spec.Template.Annotations == nil {
+		deployment.Spec.Template.Annotations = make(map[string]string)
+	}
+	deployment.Spec.Template.Annotations[configHashAnnotation] = r.configHash(web, inst)
+	if hash := authHash(web); hash != "" {
+		deployment.Spec.Template.Annotations[authHashAnnotation] = hash
+	} else {
+		delete(deployment.Spec.Template.Annotations, authHashAnnotation)
+	}
+	if vol := dataVolume(deployment); vol != nil {
+		vol.ConfigMap.Name = inst.dataCM
+	} else {
+		deployment.Spec.Template.Spec.Volumes = append(deployment.Spec.Template.Spec.Volumes, corev1.Volume{
+			Name: dataVolName,
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{Name: inst.dataCM},
+				},
+			},
+		})
+	}
+	if !hasAuthVolume(deployment) {
+		deployment.Spec.Template.Spec.Volumes = append(deployment.Spec.Template.Spec.Volumes, authVolume(inst))
+		deployment.Spec.Template.Spec.Containers[0].VolumeMounts = append(
+			deployment.Spec.Template.Spec.Containers[0].VolumeMounts, authVolumeMount())
+	}
 	if err := r.Update(ctx, deployment); err != nil {
 		return err
 	}
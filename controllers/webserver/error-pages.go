@@ -0,0 +1,60 @@
+package webserver
+
+import (
+	"sort"
+
+	"github.com/tomasji/webid-operator/controllers/pages"
+)
+
+// defaultErrorCodes are served by the stock 50x.html of the nginx image, unless covered by error pages
+var defaultErrorCodes = []int32{500, 502, 503, 504}
+
+// nginxErrorPage holds an error_page directive rendered into the nginx config
+type nginxErrorPage struct {
+	Code int32
+	Name string
+}
+
+// errorPages returns the error pages of the published files sorted by code, if several files have the same code,
+// the first one by name is used
+func errorPages(info pages.PageInfo) []nginxErrorPage {
+	names := make([]string, 0, len(info))
+	for name := range info {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	seen := make(map[int32]bool)
+	var list []nginxErrorPage
+	for _, name := range names {
+		if code := info[name].ErrorCode; code != 0 && !seen[code] {
+			seen[code] = true
+			list = append(list, nginxErrorPage{Code: code, Name: name})
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Code < list[j].Code })
+	return list
+}
+
+// errorCodes returns the codes of the error pages (see WebServer status.errorCodes)
+func errorCodes(info pages.PageInfo) []int32 {
+	var codes []int32
+	for _, page := range errorPages(info) {
+		codes = append(codes, page.Code)
+	}
+	return codes
+}
+
+// stockErrorCodes returns the default error codes not covered by the error pages
+func stockErrorCodes(errorPages []nginxErrorPage) []int32 {
+	var codes []int32
+	for _, code := range defaultErrorCodes {
+		covered := false
+		for _, page := range errorPages {
+			covered = covered || page.Code == code
+		}
+		if !covered {
+			codes = append(codes, code)
+		}
+	}
+	return codes
+}
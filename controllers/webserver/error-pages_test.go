@@ -0,0 +1,67 @@
+package webserver
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+	"github.com/tomasji/webid-operator/controllers/pages"
+)
+
+var _ = Describe("Error pages", func() {
+	info := pages.PageInfo{
+		"index.html":     {},
+		"oops.html":      {ErrorCode: 500},
+		"missing.html":   {ErrorCode: 404},
+		"gone.html":      {ErrorCode: 404},
+		"down.html":      {ErrorCode: 503, ContentType: "text/html"},
+		"not-error.html": {CSP: "default-src 'none'"},
+	}
+
+	It("returns the error pages sorted by code, the first file by name wins", func() {
+		Expect(errorPages(info)).To(Equal([]nginxErrorPage{
+			{Code: 404, Name: "gone.html"},
+			{Code: 500, Name: "oops.html"},
+			{Code: 503, Name: "down.html"},
+		}))
+		Expect(errorCodes(info)).To(Equal([]int32{404, 500, 503}))
+	})
+
+	It("returns no error pages of files without error codes", func() {
+		Expect(errorPages(pages.PageInfo{"index.html": {}})).To(BeEmpty())
+		Expect(errorCodes(nil)).To(BeEmpty())
+	})
+
+	DescribeTable("stock error codes not covered by error pages",
+		func(errorPages []nginxErrorPage, expected []int32) {
+			Expect(stockErrorCodes(errorPages)).To(Equal(expected))
+		},
+		Entry("no error pages", nil, defaultErrorCodes),
+		Entry("some covered", []nginxErrorPage{{Code: 404}, {Code: 502}, {Code: 503}}, []int32{500, 504}),
+		Entry("all covered", []nginxErrorPage{{Code: 500}, {Code: 502}, {Code: 503}, {Code: 504}}, []int32(nil)),
+	)
+
+	It("renders error_page directives into the nginx config", func() {
+		web := &webidv1alpha1.WebServer{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web"},
+			Spec: webidv1alpha1.WebServerSpec{PathPrefix: "/docs/"}}
+		c := string(nginxConfig(web, &instance{info: info}, testConfig()))
+		Expect(c).To(ContainSubstring("error_page   404  /docs/gone.html;"))
+		Expect(c).To(ContainSubstring("error_page   500  /docs/oops.html;"))
+		Expect(c).To(ContainSubstring("error_page   503  /docs/down.html;"))
+		Expect(c).NotTo(ContainSubstring("missing.html"))
+		Expect(c).To(ContainSubstring("error_page   502 504  /50x.html;"))
+		Expect(c).To(ContainSubstring("location = /50x.html {"))
+	})
+
+	It("does not render the stock page if all codes are covered", func() {
+		web := &webidv1alpha1.WebServer{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web"},
+			Spec: webidv1alpha1.WebServerSpec{PathPrefix: "/"}}
+		covered := pages.PageInfo{"error.html": {ErrorCode: 500}, "bad-gateway.html": {ErrorCode: 502},
+			"unavailable.html": {ErrorCode: 503}, "timeout.html": {ErrorCode: 504}}
+		c := string(nginxConfig(web, &instance{info: covered}, testConfig()))
+		Expect(c).To(ContainSubstring("error_page   502  /bad-gateway.html;"))
+		Expect(c).NotTo(ContainSubstring("50x.html"))
+	})
+})
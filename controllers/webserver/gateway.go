@@ -0,0 +1,289 @@
+package webserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	netv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+	"github.com/tomasji/webid-operator/controllers/pages"
+)
+
+// httpRouteGVK is the Gateway API HTTPRoute, it is handled as unstructured object (Gateway API types are not a dependency)
+var httpRouteGVK = schema.GroupVersionKind{Group: "gateway.networking.k8s.io", Version: "v1beta1", Kind: "HTTPRoute"}
+
+// routeHashAnnotation is set on the HTTPRoute, so that it is updated when its spec changes
+const routeHashAnnotation = "webid.golang.betsys.com/route-hash"
+
+// WebServer conditions reflecting the HTTPRoute conditions (of the main instance)
+const (
+	typeRouteAccepted     = "RouteAccepted"
+	typeRouteResolvedRefs = "RouteResolvedRefs"
+)
+
+func newHTTPRoute() *unstructured.Unstructured {
+	route := &unstructured.Unstructured{}
+	route.SetGroupVersionKind(httpRouteGVK)
+	return route
+}
+
+// exposureType returns spec.exposure.type of the web server, 'ingress' by default
+func exposureType(web *webidv1alpha1.WebServer) webidv1alpha1.ExposureType {
+	if web.Spec.Exposure == nil || web.Spec.Exposure.Type == "" {
+		return webidv1alpha1.ExposureIngress
+	}
+	return web.Spec.Exposure.Type
+}
+
+// reconcileExposure creates the Ingress or the HTTPRoute of the instance (see spec.exposure)
+// and deletes the one not used
+func (r *Reconciler) reconcileExposure(ctx context.Context, web *webidv1alpha1.WebServer, inst *instance) (*webidv1alpha1.WebServer, error) {
+	var err error
+	typ := exposureType(web)
+	if typ == webidv1alpha1.ExposureIngress {
+		if web, err = r.reconcileIngress(ctx, web, inst); err != nil {
+			return web, err
+		}
+	} else if web, err = r.deleteIngress(ctx, web, inst); err != nil {
+		return web, err
+	}
+
+	if typ == webidv1alpha1.ExposureGateway {
+		return r.reconcileHTTPRoute(ctx, web, inst)
+	}
+	return r.deleteHTTPRoute(ctx, web, inst)
+}
+
+// deleteIngress deletes the ingress of the instance, if it exists and is controlled by the web server
+func (r *Reconciler) deleteIngress(ctx context.Context, web *webidv1alpha1.WebServer, inst *instance) (*webidv1alpha1.WebServer, error) {
+	ingress := &netv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: inst.name, Namespace: web.Namespace}}
+	deleted, err := r.deleteControlled(ctx, web, ingress)
+	if err != nil {
+		return r.failWithStatus(ctx, web, err, "Failed to delete ingress")
+	}
+	if deleted {
+		log.FromContext(ctx).Info("Deleted Ingress", "namespace", web.Namespace, "name", inst.name)
+	}
+	return web, nil
+}
+
+// reconcileHTTPRoute gets the HTTPRoute (NS is same as of the web resource, name is the instance name)
+// - if not found, create it, if it differs, update it. The route conditions are copied to the web status.
+func (r *Reconciler) reconcileHTTPRoute(ctx context.Context, web *webidv1alpha1.WebServer, inst *instance) (*webidv1alpha1.WebServer, error) {
+	debug := log.FromContext(ctx).V(1).Info
+	nsName := types.NamespacedName{Namespace: web.Namespace, Name: inst.name}
+
+	if web.Spec.Exposure.Gateway == nil {
+		return r.failWithStatus(ctx, web, fmt.Errorf("spec.exposure.gateway is not set"), "Invalid exposure")
+	}
+	spec := r.httpRouteSpec(web, inst)
+	hash, err := routeHash(spec)
+	if err != nil {
+		return r.failWithStatus(ctx, web, err, "Failed to hash HTTPRoute")
+	}
+
+	// Get the HTTPRoute
+	debug("checking HTTPRoute", "name", inst.name)
+	route := newHTTPRoute()
+	if err := r.Get(ctx, nsName, route); err != nil {
+		// generic error
+		if !apierrors.IsNotFound(err) {
+			return r.failWithStatus(ctx, web, err, "Failed to fetch HTTPRoute")
+		}
+
+		// HTTPRoute not found - create it
+		if err = r.createHTTPRoute(ctx, web, inst, spec, hash); err != nil {
+			return r.failWithStatus(ctx, web, err, "Failed to create HTTPRoute")
+		}
+		return web, nil
+	}
+
+	// HTTPRoute found - check it and update it if needed
+	debug("HTTPRoute found", "name", inst.name)
+	if route.GetAnnotations()[routeHashAnnotation] != hash {
+		if err = unstructured.SetNestedField(route.Object, spec, "spec"); err != nil {
+			return r.failWithStatus(ctx, web, err, "Failed to update HTTPRoute")
+		}
+		setAnnotation(route, routeHashAnnotation, hash)
+		log.FromContext(ctx).Info("Updating HTTPRoute", "namespace", route.GetNamespace(), "name", route.GetName())
+		if err = r.Update(ctx, route); err != nil {
+			return r.failWithStatus(ctx, web, err, "Failed to update HTTPRoute")
+		}
+	}
+	if inst.name == web.Name {
+		setRouteConditions(web, route)
+	}
+	return web, nil
+}
+
+// httpRouteSpec returns the spec of the HTTPRoute of the instance
+func (r *Reconciler) httpRouteSpec(web *webidv1alpha1.WebServer, inst *instance) map[string]interface{} {
+	gw := web.Spec.Exposure.Gateway
+	parentRef := map[string]interface{}{"name": gw.Name}
+	if gw.Namespace != "" {
+		parentRef["namespace"] = gw.Namespace
+	}
+	if gw.SectionName != "" {
+		parentRef["sectionName"] = gw.SectionName
+	}
+
+	hostnames := []interface{}{inst.host}
+	if len(gw.Hostnames) > 0 && inst.name == web.Name {
+		hostnames = hostnames[:0]
+		for _, h := range gw.Hostnames {
+			hostnames = append(hostnames, h)
+		}
+	}
+	pathPrefix := gw.PathPrefix
+	if pathPrefix == "" {
+		pathPrefix = pages.PathPrefix(web)
+	}
+
+	return map[string]interface{}{
+		"parentRefs": []interface{}{parentRef},
+		"hostnames":  hostnames,
+		"rules": []interface{}{
+			map[string]interface{}{
+				"matches": []interface{}{
+					map[string]interface{}{
+						"path": map[string]interface{}{"type": "PathPrefix", "value": pathPrefix},
+					},
+				},
+				"backendRefs": []interface{}{
+					map[string]interface{}{"name": inst.name, "port": int64(serviceSpec(web).Port)},
+				},
+			},
+		},
+	}
+}
+
+// routeHash returns the hash of the HTTPRoute spec
+func routeHash(spec map[string]interface{}) (string, error) {
+	b, err := json.Marshal(spec)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// createHTTPRoute creates a HTTPRoute, set ownership to web
+func (r *Reconciler) createHTTPRoute(ctx context.Context, web *webidv1alpha1.WebServer, inst *instance,
+	spec map[string]interface{}, hash string) error {
+	log := log.FromContext(ctx)
+
+	route := newHTTPRoute()
+	route.SetName(inst.name)
+	route.SetNamespace(web.Namespace)
+	route.SetLabels(map[string]string{
+		"app.kubernetes.io/name":    inst.name + "-nginx",
+		"app.kubernetes.io/part-of": "webid-operator",
+	})
+	setAnnotation(route, routeHashAnnotation, hash)
+	if err := unstructured.SetNestedField(route.Object, spec, "spec"); err != nil {
+		return err
+	}
+
+	// Set the ownerRef for the HTTPRoute
+	// More info: https://kubernetes.io/docs/concepts/overview/working-with-objects/owners-dependents/
+	if err := ctrl.SetControllerReference(web, route, r.Scheme); err != nil {
+		return err
+	}
+
+	log.Info("Creating a new HTTPRoute", "namespace", route.GetNamespace(), "name", route.GetName())
+	if err := r.Create(ctx, route); err != nil {
+		log.Error(err, "Failed to create new HTTPRoute", "HTTPRoute.Namespace",
+			route.GetNamespace(), "HTTPRoute.Name", route.GetName())
+		return err
+	}
+	log.V(1).Info("HTTPRoute created", "namespace", route.GetNamespace(), "name", route.GetName())
+	return nil
+}
+
+// deleteHTTPRoute deletes the HTTPRoute of the instance, if it exists, is controlled by the web server
+// and the Gateway API is installed, and removes the route conditions from the web status
+func (r *Reconciler) deleteHTTPRoute(ctx context.Context, web *webidv1alpha1.WebServer, inst *instance) (*webidv1alpha1.WebServer, error) {
+	if inst.name == web.Name {
+		meta.RemoveStatusCondition(&web.Status.Conditions, typeRouteAccepted)
+		meta.RemoveStatusCondition(&web.Status.Conditions, typeRouteResolvedRefs)
+	}
+	route := newHTTPRoute()
+	route.SetName(inst.name)
+	route.SetNamespace(web.Namespace)
+	deleted, err := r.deleteControlled(ctx, web, route)
+	if meta.IsNoMatchError(err) {
+		return web, nil
+	}
+	if err != nil {
+		return r.failWithStatus(ctx, web, err, "Failed to delete HTTPRoute")
+	}
+	if deleted {
+		log.FromContext(ctx).Info("Deleted HTTPRoute", "namespace", web.Namespace, "name", inst.name)
+	}
+	return web, nil
+}
+
+// setRouteConditions copies the Accepted and ResolvedRefs conditions of the HTTPRoute (as set by the gateway
+// controller for the parent Gateway) to the web status, they are Unknown until the route is processed
+func setRouteConditions(web *webidv1alpha1.WebServer, route *unstructured.Unstructured) {
+	conds := map[string]metav1.Condition{
+		"Accepted":     {Status: metav1.ConditionUnknown, Reason: "Pending", Message: "HTTPRoute not processed by the Gateway yet"},
+		"ResolvedRefs": {Status: metav1.ConditionUnknown, Reason: "Pending", Message: "HTTPRoute not processed by the Gateway yet"},
+	}
+	parents, _, _ := unstructured.NestedSlice(route.Object, "status", "parents")
+	for _, p := range parents {
+		parent, ok := p.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if name, _, _ := unstructured.NestedString(parent, "parentRef", "name"); name != web.Spec.Exposure.Gateway.Name {
+			continue
+		}
+		list, _, _ := unstructured.NestedSlice(parent, "conditions")
+		for _, c := range list {
+			cond, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			typ, _, _ := unstructured.NestedString(cond, "type")
+			if _, ok := conds[typ]; !ok {
+				continue
+			}
+			status, _, _ := unstructured.NestedString(cond, "status")
+			reason, _, _ := unstructured.NestedString(cond, "reason")
+			message, _, _ := unstructured.NestedString(cond, "message")
+			conds[typ] = metav1.Condition{Status: metav1.ConditionStatus(status), Reason: reason, Message: message}
+		}
+	}
+
+	for typ, webTyp := range map[string]string{"Accepted": typeRouteAccepted, "ResolvedRefs": typeRouteResolvedRefs} {
+		cond := conds[typ]
+		cond.Type = webTyp
+		if cond.Reason == "" {
+			cond.Reason = typ
+		}
+		meta.SetStatusCondition(&web.Status.Conditions, cond)
+	}
+}
+
+func setAnnotation(obj *unstructured.Unstructured, key, value string) {
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+	annotations[key] = value
+	obj.SetAnnotations(annotations)
+}
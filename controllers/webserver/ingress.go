@@ -12,16 +12,17 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log"
 
 	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+	"github.com/tomasji/webid-operator/controllers/pages"
 )
 
-// reconcileIngress gets the ingress (NS+name is same as of the web resource)
-// - if not found, create it
-func (r *Reconciler) reconcileIngress(ctx context.Context, web *webidv1alpha1.WebServer) (*webidv1alpha1.WebServer, error) {
+// reconcileIngress gets the ingress (NS is same as of the web resource, name is the instance name)
+// - if not found, create it. Its address is reported in the web status, unless the LoadBalancer service has one.
+func (r *Reconciler) reconcileIngress(ctx context.Context, web *webidv1alpha1.WebServer, inst *instance) (*webidv1alpha1.WebServer, error) {
 	debug := log.FromContext(ctx).V(1).Info
-	nsName := types.NamespacedName{Namespace: web.Namespace, Name: web.Name}
+	nsName := types.NamespacedName{Namespace: web.Namespace, Name: inst.name}
 
 	// Get the ingress
-	debug("checking ingress", "name", web.Name)
+	debug("checking ingress", "name", inst.name)
 	ingress := &netv1.Ingress{}
 	if err := r.Get(ctx, nsName, ingress); err != nil {
 		// generic error
@@ -30,31 +31,40 @@ func (r *Reconciler) reconcileIngress(ctx context.Context, web *webidv1alpha1.We
 		}
 
 		// ingress not found - create it
-		if err = r.createIngress(ctx, web); err != nil {
+		if err = r.createIngress(ctx, web, inst); err != nil {
 			return r.failWithStatus(ctx, web, err, "Failed to create ingress")
 		}
 		return web, nil
 	}
 
 	// ingress found - check it and update it if needed
-	debug("ingress found", "name", web.Name)
+	debug("ingress found", "name", inst.name)
+	if inst.name == web.Name && web.Status.Address == "" {
+		for _, lb := range ingress.Status.LoadBalancer.Ingress {
+			if web.Status.Address = lb.IP; lb.IP == "" {
+				web.Status.Address = lb.Hostname
+			}
+			if web.Status.Address != "" {
+				break
+			}
+		}
+	}
 	return web, nil
 }
 
 // createIngress creates a ingress, set ownership to web
-func (r *Reconciler) createIngress(ctx context.Context, web *webidv1alpha1.WebServer) error {
-	const httpPort = "http"
+func (r *Reconciler) createIngress(ctx context.Context, web *webidv1alpha1.WebServer, inst *instance) error {
 	const indexFileName = "index.html"
 
 	log := log.FromContext(ctx)
 	labels := map[string]string{
-		"app.kubernetes.io/name":    web.Name + "-nginx",
+		"app.kubernetes.io/name":    inst.name + "-nginx",
 		"app.kubernetes.io/part-of": "webid-operator",
 	}
 
 	ingress := &netv1.Ingress{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      web.Name,
+			Name:      inst.name,
 			Namespace: web.Namespace,
 			Labels:    labels,
 		},
@@ -62,16 +72,16 @@ func (r *Reconciler) createIngress(ctx context.Context, web *webidv1alpha1.WebSe
 			IngressClassName: &r.Cfg.IngressClass,
 			Rules: []netv1.IngressRule{
 				{
-					Host: r.Cfg.IngressDomain,
+					Host: inst.host,
 					IngressRuleValue: netv1.IngressRuleValue{
 						HTTP: &netv1.HTTPIngressRuleValue{
 							Paths: []netv1.HTTPIngressPath{
 								{
-									Path:     "/",
+									Path:     pages.PathPrefix(web),
 									PathType: ptr(netv1.PathTypePrefix),
 									Backend: netv1.IngressBackend{
 										Service: &netv1.IngressServiceBackend{
-											Name: web.Name,
+											Name: inst.name,
 											Port: netv1.ServiceBackendPort{Name: httpPort},
 										},
 									},
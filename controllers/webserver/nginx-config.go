@@ -0,0 +1,326 @@
+package webserver
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+	"github.com/tomasji/webid-operator/controllers/config"
+	"github.com/tomasji/webid-operator/controllers/pages"
+)
+
+// fingerprinted matches asset names containing a content hash, e.g. 'app.3f2a9b1c.js' or 'logo-3f2a9b1c.png'
+var fingerprinted = regexp.MustCompile(`[.-][0-9a-fA-F]{8,}\.[a-zA-Z0-9]+$`)
+
+// nginxFile holds per-file settings rendered into the nginx config
+type nginxFile struct {
+	Name        string
+	ContentType string
+	Immutable   bool
+	// NoCache is set for index.html of a single-page application, it must be revalidated to pick up new assets
+	NoCache bool
+	Access  *nginxAccess
+	// Headers are the response headers of the file, they replace the server ones (nginx does not merge them)
+	Headers []nginxHeader
+}
+
+// nginxAccess holds an access rule rendered into a location (see WebServerSpec.Access)
+type nginxAccess struct {
+	Realm    string
+	UserFile string
+	Allow    []string
+	Deny     []string
+}
+
+// nginxPath holds a location with its own access rule
+type nginxPath struct {
+	Path   string
+	Access *nginxAccess
+}
+
+// nginxParams holds all the values rendered into the nginx config
+type nginxParams struct {
+	// Listen are the addresses nginx listens on
+	Listen []string
+	// PathPrefix is the location of the pages, the '<base href>' is set to it if it is not '/'
+	PathPrefix string
+	// SPA is set in the single-page application mode, unknown paths fall back to index.html
+	SPA bool
+	// Fallback is the last try_files parameter in the SPA mode: index.html, or 404 if it is not published
+	// (nginx would loop on the internal redirect to a missing index.html)
+	Fallback string
+	// Redirect is PathPrefix without the trailing slash, it is redirected to PathPrefix
+	Redirect string
+	// Access is the server-wide access rule, nil if not set
+	Access *nginxAccess
+	// Headers are the security headers of the server
+	Headers   []nginxHeader
+	Paths     []nginxPath
+	Files     []nginxFile
+	Redirects []nginxRedirect
+	Proxies   []nginxProxy
+	// DefaultType is the content type of files with unknown extensions, it is not HTML if the pages are sanitized
+	DefaultType string
+	// Resolver is the DNS server the proxy upstreams are resolved with (per request, see config.Config)
+	Resolver string
+	// ErrorPages are the published error pages, StockErrors the codes served by the stock 50x.html
+	ErrorPages  []nginxErrorPage
+	StockErrors []int32
+}
+
+// newNginxAccess returns the access rule to be rendered, the index is the one of the path rule (-1 for server-wide)
+func newNginxAccess(rule *webidv1alpha1.AccessRule, index int) *nginxAccess {
+	access := &nginxAccess{Allow: rule.Allow, Deny: rule.Deny}
+	if rule.BasicAuth != nil {
+		access.Realm = strings.NewReplacer(`"`, "", `\`, "").Replace(rule.BasicAuth.Realm)
+		access.UserFile = authMountPath + "/" + authFile(index)
+	}
+	return access
+}
+
+// fileAccess returns the access rule of the file - of the longest matching path, or the server-wide one
+func (p *nginxParams) fileAccess(name string) *nginxAccess {
+	access, longest := p.Access, -1
+	for _, path := range p.Paths {
+		rel := strings.TrimPrefix(path.Path, p.PathPrefix)
+		if strings.HasPrefix(name, rel) && len(rel) > longest {
+			access, longest = path.Access, len(rel)
+		}
+	}
+	return access
+}
+
+// pathsWithoutProxies returns the access paths not proxied, a proxy location applies the access rule itself
+// (nginx does not allow two locations with the same path)
+func (p *nginxParams) pathsWithoutProxies() []nginxPath {
+	proxied := make(map[string]bool)
+	for _, proxy := range p.Proxies {
+		proxied[proxy.Path] = true
+	}
+	var paths []nginxPath
+	for _, path := range p.Paths {
+		if !proxied[path.Path] {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// nginxConfig generates the nginx configuration for the given web server and its instance - published files
+// (the contents are used to compute CSP hashes of inline scripts), redirects and proxies
+func nginxConfig(web *webidv1alpha1.WebServer, inst *instance, cfg *config.Config) []byte {
+	info, contents := inst.info, inst.contents
+	prefix := pages.PathPrefix(web)
+	params := nginxParams{PathPrefix: prefix, Redirect: strings.TrimSuffix(prefix, "/"), Headers: securityHeaders(web),
+		Listen: nginxListen(web), SPA: web.Spec.Mode == webidv1alpha1.WebServerModeSPA, Fallback: "=404",
+		DefaultType: "text/html", Resolver: cfg.Resolver}
+	sanitized := pages.Sanitized(web)
+	if sanitized {
+		params.DefaultType = "application/octet-stream"
+	}
+	if _, ok := info["index.html"]; ok {
+		params.Fallback = prefix + "index.html"
+	}
+	if web.Spec.Access != nil {
+		if rule := web.Spec.Access.AccessRule; rule.BasicAuth != nil || len(rule.Allow) > 0 || len(rule.Deny) > 0 {
+			params.Access = newNginxAccess(&rule, -1)
+		}
+		for i := range web.Spec.Access.Paths {
+			path := &web.Spec.Access.Paths[i]
+			params.Paths = append(params.Paths, nginxPath{Path: prefix + path.Path, Access: newNginxAccess(&path.AccessRule, i)})
+		}
+	}
+	params.Redirects = nginxRedirects(web, inst.redirects, info)
+	params.Proxies = nginxProxies(web, prefix, cfg.ClusterDomain, inst.proxies)
+	for i := range params.Proxies {
+		params.Proxies[i].Access = params.fileAccess(strings.TrimPrefix(params.Proxies[i].Path, prefix))
+	}
+	params.Paths = params.pathsWithoutProxies()
+	params.ErrorPages = errorPages(info)
+	params.StockErrors = stockErrorCodes(params.ErrorPages)
+	names := make([]string, 0, len(info))
+	for name := range info {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		file := nginxFile{
+			Name:        name,
+			ContentType: info[name].ContentType,
+			Immutable:   fingerprinted.MatchString(name),
+			NoCache:     params.SPA && name == "index.html",
+			Access:      params.fileAccess(name),
+			Headers:     fileHeaders(params.Headers, name, info[name], contents[name]),
+		}
+		if sanitized && file.ContentType == "" && filepath.Ext(name) == "" {
+			file.ContentType = "text/html" // sanitized as HTML, see pages.IsHTML
+		}
+		if file.Headers == nil && (file.Immutable || file.NoCache) {
+			file.Headers = params.Headers
+		}
+		if file.ContentType != "" || file.Immutable || file.NoCache || file.Headers != nil {
+			params.Files = append(params.Files, file)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	if err := nginxConfigTemplate.Execute(buf, params); err != nil {
+		panic(err) // the template is static, it can fail only because of a programming error
+	}
+	return buf.Bytes()
+}
+
+// configHash returns a short hash of nginx config, it is used to roll out pods when the config changes
+func configHash(config []byte) string {
+	h := sha1.Sum(config)
+	return hex.EncodeToString(h[:])[:16]
+}
+
+var nginxConfigTemplate = template.Must(template.New("nginx").Parse(`
+server {
+{{- range .Listen }}
+    listen  {{ . }};
+{{- end }}
+    server_name  localhost;
+    root   /var/www;
+{{- range .Headers }}
+    add_header {{ .Name }} "{{ .Value }}" always;
+{{- end }}
+{{- if ne .PathPrefix "/" }}
+
+    sub_filter '<head>' '<head><base href="{{ .PathPrefix }}">';
+    sub_filter_once on;
+
+    location = {{ .Redirect }} {
+        return 301 {{ .PathPrefix }};
+    }
+{{- end }}
+
+    location {{ .PathPrefix }} {
+        alias /var/www/;
+        {{- if .SPA }}
+        default_type {{ .DefaultType }};
+        index  index.html;
+        try_files $uri $uri/ {{ .Fallback }};
+        {{- else }}
+        autoindex on;
+        autoindex_exact_size off;
+        autoindex_format html;
+        autoindex_localtime on;
+        default_type {{ .DefaultType }};
+        index  index.html index.htm;
+        {{- end }}
+        {{- template "access" .Access }}
+    }
+{{- range .Paths }}
+
+    location {{ .Path }} {
+        alias /var/www/{{ slice .Path (len $.PathPrefix) }};
+        {{- if $.SPA }}
+        default_type {{ $.DefaultType }};
+        index  index.html;
+        try_files $uri $uri/ {{ $.Fallback }};
+        {{- else }}
+        autoindex on;
+        default_type {{ $.DefaultType }};
+        index  index.html index.htm;
+        {{- end }}
+        {{- template "access" .Access }}
+    }
+{{- end }}
+{{- range .Files }}
+
+    location = {{ $.PathPrefix }}{{ .Name }} {
+        alias /var/www/{{ .Name }};
+        {{- if .ContentType }}
+        types { }
+        default_type {{ .ContentType }};
+        {{- else }}
+        default_type {{ $.DefaultType }};
+        {{- end }}
+        {{- if .Immutable }}
+        add_header Cache-Control "public, max-age=31536000, immutable";
+        {{- end }}
+        {{- if .NoCache }}
+        add_header Cache-Control "no-cache" always;
+        {{- end }}
+        {{- range .Headers }}
+        add_header {{ .Name }} "{{ .Value }}" always;
+        {{- end }}
+        {{- template "access" .Access }}
+    }
+{{- end }}
+
+{{- if .Proxies }}
+
+    resolver {{ .Resolver }} valid=10s;
+{{- end }}
+{{- range .Proxies }}
+
+    location {{ .Path }} {
+        set $upstream {{ .Upstream }};
+        proxy_pass $upstream;
+        proxy_set_header Host $host;
+        proxy_set_header X-Real-IP $remote_addr;
+        proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+        proxy_set_header X-Forwarded-Proto $scheme;
+        {{- if .ConnectTimeout }}
+        proxy_connect_timeout {{ .ConnectTimeout }};
+        {{- end }}
+        {{- if .ReadTimeout }}
+        proxy_read_timeout {{ .ReadTimeout }};
+        {{- end }}
+        {{- if .SendTimeout }}
+        proxy_send_timeout {{ .SendTimeout }};
+        {{- end }}
+        {{- template "access" .Access }}
+    }
+{{- end }}
+
+{{- range .Redirects }}
+
+    location {{ if .Regex }}~{{ else }}={{ end }} "{{ .From }}" {
+        return {{ .Code }} "{{ .To }}";
+    }
+{{- end }}
+
+{{- range .ErrorPages }}
+
+    error_page   {{ .Code }}  {{ $.PathPrefix }}{{ .Name }};
+{{- end }}
+{{- if .StockErrors }}
+
+    error_page  {{ range .StockErrors }} {{ . }}{{ end }}  /50x.html;
+    location = /50x.html {
+        root   /usr/share/nginx/html;
+    }
+{{- end }}
+}
+{{- define "access" }}
+{{- if . }}
+{{- if .UserFile }}
+        auth_basic "{{ .Realm }}";
+        auth_basic_user_file {{ .UserFile }};
+{{- else }}
+        auth_basic off;
+{{- end }}
+{{- range .Deny }}
+        deny {{ . }};
+{{- end }}
+{{- range .Allow }}
+        allow {{ . }};
+{{- end }}
+{{- if .Allow }}
+        deny all;
+{{- else }}
+        allow all;
+{{- end }}
+{{- end }}
+{{- end }}
+`))
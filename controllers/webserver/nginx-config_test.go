@@ -0,0 +1,71 @@
+package webserver
+
+import (
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+	"github.com/tomasji/webid-operator/controllers/pages"
+)
+
+var _ = Describe("nginxConfig", func() {
+	newWeb := func(prefix string, mode webidv1alpha1.WebServerMode) *webidv1alpha1.WebServer {
+		return &webidv1alpha1.WebServer{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web"},
+			Spec: webidv1alpha1.WebServerSpec{PathPrefix: prefix, Mode: mode}}
+	}
+	config := func(web *webidv1alpha1.WebServer, info pages.PageInfo) string {
+		return string(nginxConfig(web, &instance{info: info}, testConfig()))
+	}
+
+	It("serves static files with directory listing", func() {
+		c := config(newWeb("/", ""), pages.PageInfo{"index.html": {}})
+		Expect(c).To(ContainSubstring("autoindex on;"))
+		Expect(c).NotTo(ContainSubstring("try_files"))
+		Expect(c).NotTo(ContainSubstring("sub_filter"))
+	})
+
+	It("redirects the path prefix without the trailing slash and sets the base", func() {
+		c := config(newWeb("/docs/", ""), nil)
+		Expect(c).To(ContainSubstring("location = /docs {\n        return 301 /docs/;\n    }"))
+		Expect(c).To(ContainSubstring(`<head><base href="/docs/">`))
+	})
+
+	DescribeTable("single-page application fallback",
+		func(info pages.PageInfo, fallback string) {
+			web := newWeb("/app/", webidv1alpha1.WebServerModeSPA)
+			web.Spec.Access = &webidv1alpha1.AccessSpec{Paths: []webidv1alpha1.PathAccess{
+				{Path: "admin/", AccessRule: webidv1alpha1.AccessRule{Deny: []string{"all"}}}}}
+			c := config(web, info)
+			Expect(strings.Count(c, "try_files $uri $uri/ "+fallback+";")).To(Equal(2))
+			Expect(c).NotTo(ContainSubstring("autoindex"))
+		},
+		Entry("index.html", pages.PageInfo{"index.html": {}, "app.js": {}}, "/app/index.html"),
+		Entry("no index.html", pages.PageInfo{"app.js": {}}, "=404"),
+	)
+
+	It("does not cache index.html of a single-page application", func() {
+		c := config(newWeb("/", webidv1alpha1.WebServerModeSPA), pages.PageInfo{"index.html": {}})
+		Expect(c).To(ContainSubstring(`add_header Cache-Control "no-cache" always;`))
+	})
+
+	It("does not serve files with unknown extensions as HTML if the pages are sanitized", func() {
+		info := pages.PageInfo{"index.html": {}, "page.foo": {}, "about": {}}
+		c := config(newWeb("/", ""), info)
+		Expect(c).To(ContainSubstring("default_type text/html;"))
+		Expect(c).NotTo(ContainSubstring("application/octet-stream"))
+
+		web := newWeb("/", "")
+		web.Spec.Sanitize = &webidv1alpha1.SanitizeSpec{Policy: webidv1alpha1.SanitizeBasic}
+		c = config(web, info)
+		Expect(c).To(ContainSubstring("default_type application/octet-stream;"))
+		Expect(c).NotTo(ContainSubstring("location = /page.foo"))
+		// the sanitized page without an extension is still served as HTML
+		Expect(c).To(ContainSubstring("location = /about {\n        alias /var/www/about;\n        types { }\n" +
+			"        default_type text/html;"))
+		Expect(strings.Count(c, "default_type text/html;")).To(Equal(1))
+	})
+})
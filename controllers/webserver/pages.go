@@ -0,0 +1,120 @@
+package webserver
+
+import (
+	"context"
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+	"github.com/tomasji/webid-operator/controllers/pages"
+)
+
+// webServersOfPage returns the web server referenced by the page and the web servers selecting it
+func (r *Reconciler) webServersOfPage(ctx context.Context, page *webidv1alpha1.Page) []types.NamespacedName {
+	var webs []types.NamespacedName
+	if page.Spec.WebServer != "" {
+		webs = append(webs, pages.WebServerRef(page))
+	}
+	selecting, err := pages.SelectingWebServers(ctx, r.Client, page)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list webservers selecting the page", "page", page.Name)
+	}
+	for _, web := range selecting {
+		webs = append(webs, types.NamespacedName{Namespace: web.Namespace, Name: web.Name})
+	}
+	return webs
+}
+
+// webServerOfPage maps a Page to its web servers
+func (r *Reconciler) webServerOfPage(obj client.Object) []reconcile.Request {
+	webs := r.webServersOfPage(context.Background(), obj.(*webidv1alpha1.Page))
+	requests := make([]reconcile.Request, 0, len(webs))
+	for _, nsName := range webs {
+		requests = append(requests, reconcile.Request{NamespacedName: nsName})
+	}
+	return requests
+}
+
+// batched returns a handler recording the changes of the web servers returned by mapFunc in the batcher,
+// the web servers are enqueued by the batcher source when their changes are due
+func (r *Reconciler) batched(mapFunc handler.MapFunc) handler.EventHandler {
+	return handler.EnqueueRequestsFromMapFunc(func(obj client.Object) []reconcile.Request {
+		for _, req := range mapFunc(obj) {
+			r.batch.Touch(req.NamespacedName)
+		}
+		return nil
+	})
+}
+
+// webServersReferencing returns a map function, that maps a ConfigMap/Secret to the web servers of the pages
+// referencing it (using page index)
+func (r *Reconciler) webServersReferencing(indexKey string) handler.MapFunc {
+	return func(obj client.Object) []reconcile.Request {
+		ctx := context.Background()
+		list := &webidv1alpha1.PageList{}
+		opts := []client.ListOption{
+			client.InNamespace(obj.GetNamespace()),
+			client.MatchingFields{indexKey: obj.GetName()},
+		}
+		if err := r.List(ctx, list, opts...); err != nil {
+			log.FromContext(ctx).Error(err, "Failed to list pages", "index", indexKey, "name", obj.GetName())
+			return nil
+		}
+
+		webs := make(map[types.NamespacedName]bool)
+		for i := range list.Items {
+			for _, nsName := range r.webServersOfPage(ctx, &list.Items[i]) {
+				webs[nsName] = true
+			}
+		}
+		requests := make([]reconcile.Request, 0, len(webs))
+		for nsName := range webs {
+			requests = append(requests, reconcile.Request{NamespacedName: nsName})
+		}
+		return requests
+	}
+}
+
+// webServersOfGrant maps a PageGrant to the web servers it applies to: web servers in its namespace (Publish),
+// or web servers selecting pages from other namespaces (Select, using index)
+func (r *Reconciler) webServersOfGrant(obj client.Object) []reconcile.Request {
+	ctx := context.Background()
+	grant := obj.(*webidv1alpha1.PageGrant)
+	opts := []client.ListOption{client.InNamespace(grant.Namespace)}
+	if grant.Spec.Type == webidv1alpha1.PageGrantSelect {
+		opts = []client.ListOption{client.MatchingFields{pages.PageSelectorKey: pages.AnyNamespace}}
+	}
+	list := &webidv1alpha1.WebServerList{}
+	if err := r.List(ctx, list, opts...); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list webservers", "pagegrant", grant.Name)
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(list.Items))
+	for _, web := range list.Items {
+		if grant.Spec.WebServer != "" && grant.Spec.WebServer != web.Name {
+			continue
+		}
+		nsName := types.NamespacedName{Namespace: web.Namespace, Name: web.Name}
+		requests = append(requests, reconcile.Request{NamespacedName: nsName})
+	}
+	return requests
+}
+
+// pageChangedPredicate filters page events, that change the published data:
+// status updates are ignored, deletion (setting deletionTimestamp) and label changes (pageSelector) are not
+func pageChangedPredicate() predicate.Predicate {
+	return predicate.Funcs{
+		UpdateFunc: func(e event.UpdateEvent) bool {
+			return e.ObjectOld.GetGeneration() != e.ObjectNew.GetGeneration() ||
+				(e.ObjectOld.GetDeletionTimestamp() == nil) != (e.ObjectNew.GetDeletionTimestamp() == nil) ||
+				!reflect.DeepEqual(e.ObjectOld.GetLabels(), e.ObjectNew.GetLabels())
+		},
+	}
+}
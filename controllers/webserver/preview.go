@@ -0,0 +1,65 @@
+package webserver
+
+import (
+	"context"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+)
+
+// deletePreview deletes objects of the preview instance, if the preview is disabled. Only objects controlled
+// by the web server are deleted, the preview names may collide with objects of another web server
+// (e.g. the main instance of a web server named '<name>-preview').
+func (r *Reconciler) deletePreview(ctx context.Context, web *webidv1alpha1.WebServer) (*webidv1alpha1.WebServer, error) {
+	log := log.FromContext(ctx)
+	inst := r.previewInstance(web, "")
+
+	objs := []client.Object{
+		&netv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: inst.name, Namespace: web.Namespace}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: inst.name, Namespace: web.Namespace}},
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: inst.name, Namespace: web.Namespace}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: ConfigCMName(inst.name), Namespace: web.Namespace}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: HtpasswdSecretName(inst.name), Namespace: web.Namespace}},
+	}
+
+	// content-addressed data configMaps of the preview
+	list := &corev1.ConfigMapList{}
+	if err := r.List(ctx, list, client.InNamespace(web.Namespace), client.MatchingLabels{dataOfLabel: inst.name}); err != nil {
+		return r.failWithStatus(ctx, web, err, "Failed to list preview configMaps")
+	}
+	for i := range list.Items {
+		objs = append(objs, &list.Items[i])
+	}
+
+	for _, obj := range objs {
+		deleted, err := r.deleteControlled(ctx, web, obj)
+		if err != nil {
+			return r.failWithStatus(ctx, web, err, "Failed to delete preview")
+		}
+		if deleted {
+			log.Info("Deleted preview object", "namespace", web.Namespace, "name", obj.GetName())
+		}
+	}
+	return r.deleteHTTPRoute(ctx, web, inst)
+}
+
+// deleteControlled deletes the object (identified by its namespace and name) if it exists and is controlled
+// by the web server, objects of other owners with the same name are kept. It returns true if it was deleted.
+func (r *Reconciler) deleteControlled(ctx context.Context, web *webidv1alpha1.WebServer, obj client.Object) (bool, error) {
+	if err := r.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	if !metav1.IsControlledBy(obj, web) {
+		return false, nil
+	}
+	if err := r.Delete(ctx, obj, client.Preconditions{UID: ptr(obj.GetUID())}); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+	return true, nil
+}
@@ -0,0 +1,88 @@
+package webserver
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	netv1 "k8s.io/api/networking/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+)
+
+var _ = Describe("deletePreview", func() {
+	var (
+		r     *Reconciler
+		web   *webidv1alpha1.WebServer
+		other *webidv1alpha1.WebServer
+	)
+
+	// objects returns the objects of an instance, controlled by the owner
+	objects := func(owner *webidv1alpha1.WebServer, name string) []client.Object {
+		objs := []client.Object{
+			&netv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns"}},
+			&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns"}},
+			&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns"}},
+			&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: ConfigCMName(name), Namespace: "ns"}},
+			&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: HtpasswdSecretName(name), Namespace: "ns"}},
+			&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: DataCMName(name, "0123456789abcdef"), Namespace: "ns",
+				Labels: map[string]string{dataOfLabel: name}}},
+		}
+		for _, obj := range objs {
+			Expect(ctrl.SetControllerReference(owner, obj, testScheme())).To(Succeed())
+		}
+		return objs
+	}
+	exists := func(obj client.Object) bool {
+		err := r.Get(context.Background(), client.ObjectKeyFromObject(obj), obj)
+		if apierrors.IsNotFound(err) {
+			return false
+		}
+		Expect(err).NotTo(HaveOccurred())
+		return true
+	}
+
+	BeforeEach(func() {
+		web = &webidv1alpha1.WebServer{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "foo", UID: "foo-uid"}}
+		other = &webidv1alpha1.WebServer{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "foo-preview", UID: "other-uid"}}
+		r = newTestReconciler(web, other)
+	})
+
+	It("deletes the preview objects of the web server", func() {
+		objs := objects(web, "foo-preview")
+		for _, obj := range objs {
+			Expect(r.Create(context.Background(), obj)).To(Succeed())
+		}
+		_, err := r.deletePreview(context.Background(), web)
+		Expect(err).NotTo(HaveOccurred())
+		for _, obj := range objs {
+			Expect(exists(obj)).To(BeFalse(), obj.GetName())
+		}
+	})
+
+	It("keeps objects of another web server with the preview name", func() {
+		objs := objects(other, "foo-preview")
+		for _, obj := range objs {
+			Expect(r.Create(context.Background(), obj)).To(Succeed())
+		}
+		_, err := r.deletePreview(context.Background(), web)
+		Expect(err).NotTo(HaveOccurred())
+		for _, obj := range objs {
+			Expect(exists(obj)).To(BeTrue(), obj.GetName())
+		}
+	})
+
+	It("does nothing if there is no preview", func() {
+		_, err := r.deletePreview(context.Background(), web)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(r.Get(context.Background(), types.NamespacedName{Namespace: "ns", Name: "foo"}, web)).To(Succeed())
+	})
+})
@@ -0,0 +1,129 @@
+package webserver
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+)
+
+const (
+	// proxyServiceKey indexes web servers by the backend Services of their proxies (see spec.proxies)
+	proxyServiceKey = "spec.proxies.service"
+	// typeProxyServiceMissing is the condition reporting proxies with a missing backend Service
+	typeProxyServiceMissing = "ProxyServiceMissing"
+)
+
+// nginxProxy holds a location proxied to a backend Service
+type nginxProxy struct {
+	Path           string
+	Upstream       string
+	ConnectTimeout string
+	ReadTimeout    string
+	SendTimeout    string
+	Access         *nginxAccess
+}
+
+// proxyServices returns the names of the backend Services of the web server
+func proxyServices(web *webidv1alpha1.WebServer) []string {
+	var names []string
+	for _, proxy := range web.Spec.Proxies {
+		names = append(names, proxy.Service)
+	}
+	return names
+}
+
+// availableProxies returns the proxies of the web server with an existing backend Service and sets
+// the ProxyServiceMissing condition. Proxies to missing Services are not rendered (nginx would respond
+// 502 Bad Gateway), the config is re-rendered when the Service appears or is deleted (see SetupWithManager).
+func (r *Reconciler) availableProxies(ctx context.Context, web *webidv1alpha1.WebServer) ([]webidv1alpha1.ProxySpec, error) {
+	if len(web.Spec.Proxies) == 0 {
+		meta.RemoveStatusCondition(&web.Status.Conditions, typeProxyServiceMissing)
+		return nil, nil
+	}
+
+	var proxies []webidv1alpha1.ProxySpec
+	var missing []string
+	for _, proxy := range web.Spec.Proxies {
+		service := &corev1.Service{}
+		err := r.Get(ctx, types.NamespacedName{Namespace: web.Namespace, Name: proxy.Service}, service)
+		if apierrors.IsNotFound(err) {
+			missing = append(missing, proxy.Service)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		proxies = append(proxies, proxy)
+	}
+
+	condition := metav1.Condition{Type: typeProxyServiceMissing, Status: metav1.ConditionFalse,
+		Reason: "ServicesFound", Message: "All proxy backend Services exist"}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "ServiceNotFound"
+		condition.Message = fmt.Sprintf("Proxy backend Services not found: %s", strings.Join(missing, ", "))
+	}
+	meta.SetStatusCondition(&web.Status.Conditions, condition)
+	return proxies, nil
+}
+
+// nginxProxies returns the proxies to be rendered into the nginx config, the upstreams are full names
+// of the Services in the cluster domain (they are resolved by the nginx resolver, without search domains)
+func nginxProxies(web *webidv1alpha1.WebServer, prefix, clusterDomain string, proxies []webidv1alpha1.ProxySpec) []nginxProxy {
+	list := make([]nginxProxy, 0, len(proxies))
+	for _, proxy := range proxies {
+		list = append(list, nginxProxy{
+			Path:           prefix + proxy.Path,
+			Upstream:       fmt.Sprintf("http://%s.%s.svc.%s:%d", proxy.Service, web.Namespace, clusterDomain, proxy.Port),
+			ConnectTimeout: nginxDuration(proxy.ConnectTimeout),
+			ReadTimeout:    nginxDuration(proxy.ReadTimeout),
+			SendTimeout:    nginxDuration(proxy.SendTimeout),
+		})
+	}
+	return list
+}
+
+// nginxDuration returns the duration in nginx format (whole seconds, at least 1s), empty if not set
+func nginxDuration(d *metav1.Duration) string {
+	if d == nil {
+		return ""
+	}
+	secs := int64((d.Duration + time.Second - 1) / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+	return fmt.Sprintf("%ds", secs)
+}
+
+// webServersOfProxyService maps a Service to the web servers proxying to it (using index)
+func (r *Reconciler) webServersOfProxyService(obj client.Object) []reconcile.Request {
+	ctx := context.Background()
+	list := &webidv1alpha1.WebServerList{}
+	opts := []client.ListOption{
+		client.InNamespace(obj.GetNamespace()),
+		client.MatchingFields{proxyServiceKey: obj.GetName()},
+	}
+	if err := r.List(ctx, list, opts...); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list webservers", "index", proxyServiceKey, "name", obj.GetName())
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(list.Items))
+	for _, web := range list.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Namespace: web.Namespace, Name: web.Name}})
+	}
+	return requests
+}
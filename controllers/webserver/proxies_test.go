@@ -0,0 +1,66 @@
+package webserver
+
+import (
+	"context"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+)
+
+var _ = Describe("proxies", func() {
+	var web *webidv1alpha1.WebServer
+
+	BeforeEach(func() {
+		web = &webidv1alpha1.WebServer{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web"},
+			Spec: webidv1alpha1.WebServerSpec{PathPrefix: "/site/", Proxies: []webidv1alpha1.ProxySpec{
+				{Path: "api/", Service: "api", Port: 8080, ReadTimeout: &metav1.Duration{Duration: 1500 * time.Millisecond}},
+				{Path: "auth/", Service: "auth", Port: 80},
+			}}}
+	})
+
+	It("renders only proxies with an existing Service and reports the missing ones", func() {
+		r := newTestReconciler(&corev1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "api"}})
+		proxies, err := r.availableProxies(context.Background(), web)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(proxies).To(Equal(web.Spec.Proxies[:1]))
+		condition := meta.FindStatusCondition(web.Status.Conditions, typeProxyServiceMissing)
+		Expect(condition.Status).To(Equal(metav1.ConditionTrue))
+		Expect(condition.Message).To(ContainSubstring("auth"))
+	})
+
+	It("removes the condition without proxies", func() {
+		r := newTestReconciler()
+		meta.SetStatusCondition(&web.Status.Conditions, metav1.Condition{Type: typeProxyServiceMissing,
+			Status: metav1.ConditionTrue, Reason: "ServiceNotFound"})
+		web.Spec.Proxies = nil
+		Expect(r.availableProxies(context.Background(), web)).To(BeEmpty())
+		Expect(web.Status.Conditions).To(BeEmpty())
+	})
+
+	It("resolves the upstream per request, so that nginx starts without the Service", func() {
+		config := string(nginxConfig(web, &instance{proxies: web.Spec.Proxies[:1]}, testConfig()))
+		Expect(config).To(ContainSubstring("resolver kube-dns.kube-system.svc.cluster.local valid=10s;"))
+		Expect(config).To(ContainSubstring(`    location /site/api/ {
+        set $upstream http://api.ns.svc.cluster.local:8080;
+        proxy_pass $upstream;`))
+		Expect(config).To(ContainSubstring("proxy_read_timeout 2s;"))
+		Expect(string(nginxConfig(web, &instance{}, testConfig()))).NotTo(ContainSubstring("resolver"))
+	})
+
+	DescribeTable("nginxDuration",
+		func(d *metav1.Duration, expected string) {
+			Expect(nginxDuration(d)).To(Equal(expected))
+		},
+		Entry("not set", nil, ""),
+		Entry("whole seconds", &metav1.Duration{Duration: time.Minute}, "60s"),
+		Entry("rounded up", &metav1.Duration{Duration: 1100 * time.Millisecond}, "2s"),
+		Entry("at least 1s", &metav1.Duration{Duration: time.Millisecond}, "1s"),
+	)
+})
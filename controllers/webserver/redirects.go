@@ -0,0 +1,113 @@
+package webserver
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+	"github.com/tomasji/webid-operator/controllers/pages"
+)
+
+// redirectWebServerKey indexes Redirects by spec.webserver
+const redirectWebServerKey = "spec.webserver"
+
+// groupRef matches '$' not followed by a group number (an nginx variable)
+var groupRef = regexp.MustCompile(`[$]([^0-9]|$)`)
+
+// nginxRedirect holds a redirect rendered into the nginx config
+type nginxRedirect struct {
+	Regex bool
+	From  string
+	To    string
+	Code  int32
+}
+
+// listRedirects returns the valid Redirects of the web server (sorted by name), an invalid Redirect
+// is skipped (see validateRedirect)
+func (r *Reconciler) listRedirects(ctx context.Context, web *webidv1alpha1.WebServer) ([]webidv1alpha1.Redirect, error) {
+	list := &webidv1alpha1.RedirectList{}
+	opts := []client.ListOption{
+		client.InNamespace(web.Namespace),
+		client.MatchingFields{redirectWebServerKey: web.Name},
+	}
+	if err := r.List(ctx, list, opts...); err != nil {
+		return nil, err
+	}
+	redirects := make([]webidv1alpha1.Redirect, 0, len(list.Items))
+	for _, redirect := range list.Items {
+		if err := validateRedirect(&redirect.Spec); err != nil {
+			log.FromContext(ctx).Error(err, "Skipping invalid Redirect", "name", redirect.Name)
+			continue
+		}
+		redirects = append(redirects, redirect)
+	}
+	return redirects, nil
+}
+
+// validateRedirect checks the redirect can be rendered into the nginx config (as the CRD validation does,
+// the Redirect may be created before it): the regular expression compiles, the paths can not escape
+// the quoted strings and To does not reference nginx variables
+func validateRedirect(spec *webidv1alpha1.RedirectSpec) error {
+	if strings.ContainsAny(spec.From, " \t\r\n\f\v;\"'") || strings.ContainsAny(spec.To, " \t\r\n\f\v;\"'") {
+		return errors.New("from and to must not contain whitespace, ';' and quotes")
+	}
+	if strings.Contains(spec.To, `\`) {
+		return errors.New(`to must not contain \`)
+	}
+	if !spec.Regex {
+		if strings.ContainsAny(spec.From, `\${}`) {
+			return errors.New(`from must not contain \, $, { or } unless regex is set`)
+		}
+		if strings.Contains(spec.To, "$") {
+			return errors.New("to must not contain $ unless regex is set")
+		}
+		return nil
+	}
+	if groupRef.MatchString(spec.To) {
+		return errors.New("to may contain $ only as a reference to a group of the regular expression ($1)")
+	}
+	_, err := regexp.Compile(spec.From)
+	return err
+}
+
+// nginxRedirects returns the redirects to be rendered into the nginx config, redirects from the published files
+// (the page takes precedence) and duplicates are skipped
+func nginxRedirects(web *webidv1alpha1.WebServer, redirects []webidv1alpha1.Redirect, info pages.PageInfo) []nginxRedirect {
+	prefix := pages.PathPrefix(web)
+	seen := make(map[string]bool)
+	list := make([]nginxRedirect, 0, len(redirects))
+	for _, redirect := range redirects {
+		spec := redirect.Spec
+		if _, published := info[spec.From]; (published && !spec.Regex) || seen[spec.From] {
+			continue
+		}
+		seen[spec.From] = true
+
+		nr := nginxRedirect{Regex: spec.Regex, From: prefix + spec.From, To: spec.To, Code: spec.StatusCode}
+		if spec.Regex {
+			// backslashes are unescaped by nginx in quoted strings
+			nr.From = strings.ReplaceAll("^"+regexp.QuoteMeta(prefix)+strings.TrimPrefix(spec.From, "^"), `\`, `\\`)
+		}
+		if !strings.HasPrefix(spec.To, "/") && !strings.Contains(spec.To, "://") {
+			nr.To = prefix + spec.To
+		}
+		if nr.Code == 0 {
+			nr.Code = 301
+		}
+		list = append(list, nr)
+	}
+	return list
+}
+
+// webServerOfRedirect maps a Redirect to its web server
+func (r *Reconciler) webServerOfRedirect(obj client.Object) []reconcile.Request {
+	redirect := obj.(*webidv1alpha1.Redirect)
+	return []reconcile.Request{{NamespacedName: types.NamespacedName{Namespace: redirect.Namespace, Name: redirect.Spec.WebServer}}}
+}
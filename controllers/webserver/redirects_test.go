@@ -0,0 +1,73 @@
+package webserver
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+	"github.com/tomasji/webid-operator/controllers/pages"
+)
+
+var _ = Describe("redirects", func() {
+	web := &webidv1alpha1.WebServer{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web"},
+		Spec: webidv1alpha1.WebServerSpec{PathPrefix: "/docs.v1/"}}
+	redirect := func(from, to string, regex bool, code int32) webidv1alpha1.Redirect {
+		return webidv1alpha1.Redirect{Spec: webidv1alpha1.RedirectSpec{WebServer: "web", From: from, To: to,
+			Regex: regex, StatusCode: code}}
+	}
+
+	DescribeTable("validateRedirect",
+		func(r webidv1alpha1.Redirect, valid bool) {
+			err := validateRedirect(&r.Spec)
+			if valid {
+				Expect(err).NotTo(HaveOccurred())
+			} else {
+				Expect(err).To(HaveOccurred())
+			}
+		},
+		Entry("page", redirect("old.html", "new.html", false, 0), true),
+		Entry("URL", redirect("old.html", "https://example.com/?a=b&c", false, 0), true),
+		Entry("regex with group", redirect(`^blog/(\d+)\.html$`, "/posts/$1", true, 0), true),
+		Entry("quote", redirect(`old"`, "new.html", false, 0), false),
+		Entry("semicolon", redirect("old.html", "new.html;", false, 0), false),
+		Entry("whitespace", redirect("old.html", "new\n.html", false, 0), false),
+		Entry("backslash in from", redirect(`old\`, "new.html", false, 0), false),
+		Entry("dollar in from", redirect("old$", "new.html", false, 0), false),
+		Entry("braces in from", redirect("old{x}", "new.html", false, 0), false),
+		Entry("backslash in to", redirect("old.html", `new\`, false, 0), false),
+		Entry("backslash in to with regex", redirect("old", `new\`, true, 0), false),
+		Entry("variable in to", redirect("old.html", "$host", false, 0), false),
+		Entry("group in to without regex", redirect("old.html", "/$1", false, 0), false),
+		Entry("variable in to with regex", redirect("(.*)", "/$1$request_uri", true, 0), false),
+		Entry("trailing dollar in to with regex", redirect("(.*)", "/$1$", true, 0), false),
+		Entry("invalid regex", redirect("(", "/x", true, 0), false),
+	)
+
+	DescribeTable("nginxRedirects",
+		func(redirects []webidv1alpha1.Redirect, info pages.PageInfo, expected []nginxRedirect) {
+			Expect(nginxRedirects(web, redirects, info)).To(Equal(expected))
+		},
+		Entry("page", []webidv1alpha1.Redirect{redirect("old.html", "new.html", false, 0)}, nil,
+			[]nginxRedirect{{From: "/docs.v1/old.html", To: "/docs.v1/new.html", Code: 301}}),
+		Entry("absolute path and URL", []webidv1alpha1.Redirect{
+			redirect("a", "/b", false, 302), redirect("c", "https://example.com/d", false, 308)}, nil,
+			[]nginxRedirect{{From: "/docs.v1/a", To: "/b", Code: 302}, {From: "/docs.v1/c", To: "https://example.com/d", Code: 308}}),
+		Entry("regex, backslashes escaped for nginx", []webidv1alpha1.Redirect{redirect(`^blog/(\d+)\.html$`, "posts/$1", true, 0)}, nil,
+			[]nginxRedirect{{Regex: true, From: `^/docs\\.v1/blog/(\\d+)\\.html$`, To: "/docs.v1/posts/$1", Code: 301}}),
+		Entry("published page takes precedence", []webidv1alpha1.Redirect{redirect("old.html", "new.html", false, 0)},
+			pages.PageInfo{"old.html": {}}, []nginxRedirect{}),
+		Entry("duplicates skipped", []webidv1alpha1.Redirect{
+			redirect("old.html", "a.html", false, 0), redirect("old.html", "b.html", false, 0)}, nil,
+			[]nginxRedirect{{From: "/docs.v1/old.html", To: "/docs.v1/a.html", Code: 301}}),
+	)
+
+	It("renders the redirects into the nginx config", func() {
+		inst := &instance{redirects: []webidv1alpha1.Redirect{
+			redirect("old.html", "new.html", false, 0), redirect(`^blog/(\d+)$`, "/posts/$1", true, 302)}}
+		config := string(nginxConfig(web, inst, testConfig()))
+		Expect(config).To(ContainSubstring("    location = \"/docs.v1/old.html\" {\n        return 301 \"/docs.v1/new.html\";\n    }"))
+		Expect(config).To(ContainSubstring("    location ~ \"^/docs\\\\.v1/blog/(\\\\d+)$\" {\n        return 302 \"/posts/$1\";\n    }"))
+	})
+})
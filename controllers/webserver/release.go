@@ -0,0 +1,76 @@
+package webserver
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+	"github.com/tomasji/webid-operator/controllers/pages"
+)
+
+const releaseKey = "spec.release"
+
+// pinRelease sets the instance to serve the frozen pages of the Release in spec.release, the pages
+// are taken from its configMap (so that the nginx config, e.g. the script hashes, matches them)
+func (r *Reconciler) pinRelease(ctx context.Context, web *webidv1alpha1.WebServer, inst *instance) error {
+	rel := &webidv1alpha1.Release{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: web.Namespace, Name: web.Spec.Release}, rel); err != nil {
+		_, err = r.failWithStatus(ctx, web, err, "Failed to fetch release")
+		return err
+	}
+	if rel.Status.ConfigMap == "" {
+		err := fmt.Errorf("release %q is not frozen yet", rel.Name)
+		_, err = r.failWithStatus(ctx, web, err, "Release not ready")
+		return err
+	}
+	if rel.Spec.WebServer != web.Name {
+		err := fmt.Errorf("release %q belongs to WebServer %q", rel.Name, rel.Spec.WebServer)
+		_, err = r.failWithStatus(ctx, web, err, "Release of another WebServer")
+		return err
+	}
+
+	cm := &corev1.ConfigMap{}
+	if err := r.Get(ctx, types.NamespacedName{Namespace: web.Namespace, Name: rel.Status.ConfigMap}, cm); err != nil {
+		_, err = r.failWithStatus(ctx, web, err, "Failed to fetch release configMap")
+		return err
+	}
+	info, err := pages.UnmarshalInfo(cm.Annotations[pages.ContentTypesAnnotation])
+	if err != nil {
+		_, err = r.failWithStatus(ctx, web, err, "Failed to read release configMap")
+		return err
+	}
+
+	log.FromContext(ctx).V(1).Info("serving release", "release", rel.Name, "hash", rel.Status.Hash)
+	inst.release = rel.Name
+	inst.dataCM = cm.Name
+	inst.contents = cm.BinaryData
+	inst.info = info
+	return nil
+}
+
+// webServersOfRelease maps a Release to the web servers serving it (using index)
+func (r *Reconciler) webServersOfRelease(obj client.Object) []reconcile.Request {
+	ctx := context.Background()
+	list := &webidv1alpha1.WebServerList{}
+	opts := []client.ListOption{
+		client.InNamespace(obj.GetNamespace()),
+		client.MatchingFields{releaseKey: obj.GetName()},
+	}
+	if err := r.List(ctx, list, opts...); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list webservers", "release", obj.GetName())
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(list.Items))
+	for _, web := range list.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Namespace: web.Namespace, Name: web.Name},
+		})
+	}
+	return requests
+}
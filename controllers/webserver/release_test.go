@@ -0,0 +1,131 @@
+package webserver
+
+import (
+	"context"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+	"github.com/tomasji/webid-operator/controllers/pages"
+)
+
+var _ = Describe("pinRelease", func() {
+	ctx := context.Background()
+	var web *webidv1alpha1.WebServer
+
+	release := func(webServer, configMap string) *webidv1alpha1.Release {
+		return &webidv1alpha1.Release{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "v1"},
+			Spec:       webidv1alpha1.ReleaseSpec{WebServer: webServer},
+			Status:     webidv1alpha1.ReleaseStatus{ConfigMap: configMap, Hash: "0123456789abcdef"},
+		}
+	}
+	snapshot := func(info pages.PageInfo) *corev1.ConfigMap {
+		annotation, err := pages.MarshalInfo(info)
+		Expect(err).NotTo(HaveOccurred())
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "v1-0123456789",
+				Annotations: map[string]string{pages.ContentTypesAnnotation: annotation}},
+			BinaryData: map[string][]byte{"index.html": []byte("v1")},
+		}
+	}
+
+	BeforeEach(func() {
+		web = &webidv1alpha1.WebServer{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web"},
+			Spec:       webidv1alpha1.WebServerSpec{Release: "v1"},
+		}
+	})
+
+	It("serves the frozen pages of the release", func() {
+		info := pages.PageInfo{"index.html": {ContentType: "text/html"}}
+		r := newTestReconciler(web, release("web", "v1-0123456789"), snapshot(info))
+		inst := &instance{dataCM: "web-data"}
+		Expect(r.pinRelease(ctx, web, inst)).To(Succeed())
+		Expect(inst.dataCM).To(Equal("v1-0123456789"))
+		Expect(inst.info).To(Equal(info))
+	})
+
+	DescribeTable("refuses a release which cannot be served",
+		func(rel *webidv1alpha1.Release, withSnapshot bool) {
+			objs := []client.Object{web}
+			if rel != nil {
+				objs = append(objs, rel)
+			}
+			if withSnapshot {
+				objs = append(objs, snapshot(nil))
+			}
+			r := newTestReconciler(objs...)
+			inst := &instance{dataCM: "web-data"}
+			Expect(r.pinRelease(ctx, web, inst)).NotTo(Succeed())
+			Expect(inst.dataCM).To(Equal("web-data"))
+
+			stored := &webidv1alpha1.WebServer{}
+			Expect(r.Get(ctx, types.NamespacedName{Namespace: "ns", Name: "web"}, stored)).To(Succeed())
+			Expect(stored.Status.Conditions).NotTo(BeEmpty())
+			Expect(stored.Status.Conditions[0].Status).To(Equal(metav1.ConditionFalse))
+		},
+		Entry("missing release", nil, false),
+		Entry("release not frozen yet", release("web", ""), false),
+		Entry("release of another web server", release("other", "v1-0123456789"), true),
+		Entry("missing snapshot", release("web", "v1-0123456789"), false),
+	)
+})
+
+var _ = Describe("WebServer pinned to a release", func() {
+	ctx := context.Background()
+
+	It("serves the release configMap with the script hashes of the frozen pages", func() {
+		web := &webidv1alpha1.WebServer{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web", UID: "web-uid"},
+			Spec: webidv1alpha1.WebServerSpec{Release: "v1",
+				SecurityHeaders: &webidv1alpha1.SecurityHeaders{}},
+		}
+		rel := &webidv1alpha1.Release{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "v1"},
+			Spec:       webidv1alpha1.ReleaseSpec{WebServer: "web"},
+			Status:     webidv1alpha1.ReleaseStatus{ConfigMap: "v1-0123456789"},
+		}
+		frozen := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "v1-0123456789",
+				Annotations: map[string]string{pages.ContentTypesAnnotation: `{"index.html":""}`}},
+			BinaryData: map[string][]byte{"index.html": []byte("<script>frozen()</script>")},
+		}
+		c := fake.NewClientBuilder().WithScheme(testScheme()).WithObjects(web, rel, frozen).
+			WithIndex(&webidv1alpha1.Redirect{}, redirectWebServerKey, func(obj client.Object) []string {
+				return []string{obj.(*webidv1alpha1.Redirect).Spec.WebServer}
+			}).Build()
+		data := &pages.Reconciler{
+			Data: make(map[types.NamespacedName]pages.PageData),
+			Info: make(map[types.NamespacedName]pages.PageInfo),
+		}
+		data.SetData(types.NamespacedName{Namespace: "ns", Name: "web"},
+			pages.PageData{"index.html": []byte("<script>live()</script>")}, pages.PageInfo{"index.html": {}})
+		r := &Reconciler{Client: c, Scheme: testScheme(), Cfg: testConfig(), DataProvider: data}
+
+		instances, err := r.instances(ctx, web)
+		Expect(err).NotTo(HaveOccurred())
+		main := instances[0]
+		for _, reconcile := range []reconcileHelperFunc{r.reconcileConfigCM, r.reconcileDataCM} {
+			_, err = reconcile(ctx, web, main)
+			Expect(err).NotTo(HaveOccurred())
+		}
+		Expect(main.dataCM).To(Equal("v1-0123456789"))
+
+		dataCMs := &corev1.ConfigMapList{}
+		Expect(r.List(ctx, dataCMs, client.MatchingLabels{dataOfLabel: "web"})).To(Succeed())
+		Expect(dataCMs.Items).To(BeEmpty())
+
+		config := &corev1.ConfigMap{}
+		Expect(r.Get(ctx, types.NamespacedName{Namespace: "ns", Name: ConfigCMName("web")}, config)).To(Succeed())
+		Expect(string(config.BinaryData[fileConfig])).To(ContainSubstring(scriptHash("frozen()")))
+		Expect(string(config.BinaryData[fileConfig])).NotTo(ContainSubstring(scriptHash("live()")))
+	})
+})
@@ -0,0 +1,187 @@
+package webserver
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+	"github.com/tomasji/webid-operator/controllers/pages"
+)
+
+// Default values of spec.securityHeaders
+const (
+	defaultHSTSMaxAge        = 31536000
+	defaultCSP               = "default-src 'self'"
+	defaultFrameOptions      = "DENY"
+	defaultReferrerPolicy    = "strict-origin-when-cross-origin"
+	defaultPermissionsPolicy = "camera=(), microphone=(), geolocation=()"
+)
+
+const cspHeader = "Content-Security-Policy"
+
+// nginxHeader is a response header rendered into the nginx config
+type nginxHeader struct {
+	Name  string
+	Value string
+}
+
+// valueOr returns the value of the pointer, or the default if it is nil
+func valueOr[T any](p *T, def T) T {
+	if p == nil {
+		return def
+	}
+	return *p
+}
+
+// securityHeaders returns the headers of spec.securityHeaders, none if it is not set
+func securityHeaders(web *webidv1alpha1.WebServer) []nginxHeader {
+	sh := web.Spec.SecurityHeaders
+	if sh == nil {
+		return nil
+	}
+	headers := []nginxHeader{{Name: "X-Content-Type-Options", Value: "nosniff"}}
+	add := func(name, value string) {
+		if value != "" {
+			headers = append(headers, nginxHeader{Name: name, Value: value})
+		}
+	}
+	if maxAge := valueOr(sh.HSTSMaxAge, defaultHSTSMaxAge); maxAge > 0 {
+		hsts := "max-age=" + strconv.FormatInt(maxAge, 10)
+		if sh.HSTSIncludeSubDomains {
+			hsts += "; includeSubDomains"
+		}
+		add("Strict-Transport-Security", hsts)
+	}
+	add(cspHeader, valueOr(sh.ContentSecurityPolicy, defaultCSP))
+	add("X-Frame-Options", valueOr(sh.FrameOptions, defaultFrameOptions))
+	add("Referrer-Policy", valueOr(sh.ReferrerPolicy, defaultReferrerPolicy))
+	add("Permissions-Policy", valueOr(sh.PermissionsPolicy, defaultPermissionsPolicy))
+	return headers
+}
+
+// validateSecurityHeaders checks the values of spec.securityHeaders, they are rendered quoted into the nginx
+// config (the patterns are not validated for objects created by older versions)
+func validateSecurityHeaders(web *webidv1alpha1.WebServer) error {
+	for _, h := range securityHeaders(web) {
+		if strings.ContainsAny(h.Value, pages.InvalidHeaderChars) {
+			return fmt.Errorf("invalid value of %s in spec.securityHeaders", h.Name)
+		}
+	}
+	return nil
+}
+
+// fileHeaders returns the headers of the file, if its Content-Security-Policy differs from the server one
+// (it is overridden by the page, or hashes of inline scripts are added to it), nil otherwise
+func fileHeaders(server []nginxHeader, name string, info pages.FileInfo, contents []byte) []nginxHeader {
+	serverCSP := ""
+	for _, h := range server {
+		if h.Name == cspHeader {
+			serverCSP = h.Value
+		}
+	}
+	csp := info.CSP
+	if csp == "" {
+		csp = serverCSP
+	}
+	if csp != "" && pages.IsHTML(name, info.ContentType) {
+		csp = addScriptHashes(csp, inlineScriptHashes(contents))
+	}
+	if csp == serverCSP {
+		return nil
+	}
+
+	headers := make([]nginxHeader, 0, len(server)+1)
+	for _, h := range server {
+		if h.Name != cspHeader {
+			headers = append(headers, h)
+		}
+	}
+	return append(headers, nginxHeader{Name: cspHeader, Value: csp})
+}
+
+// inlineScriptHashes returns CSP hash sources ('sha256-...') of the inline scripts of the HTML contents
+func inlineScriptHashes(contents []byte) []string {
+	doc, err := html.Parse(bytes.NewReader(contents))
+	if err != nil {
+		return nil
+	}
+	var hashes []string
+	seen := make(map[string]bool)
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "script" && !hasAttr(n, "src") &&
+			n.FirstChild != nil && n.FirstChild.Type == html.TextNode {
+			sum := sha256.Sum256([]byte(n.FirstChild.Data))
+			hash := "'sha256-" + base64.StdEncoding.EncodeToString(sum[:]) + "'"
+			if !seen[hash] {
+				seen[hash] = true
+				hashes = append(hashes, hash)
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return hashes
+}
+
+func hasAttr(n *html.Node, name string) bool {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return true
+		}
+	}
+	return false
+}
+
+// addScriptHashes adds the hash sources to 'script-src' of the policy, the directive is derived from 'default-src'
+// if it is not set. The policy is not changed if it allows all inline scripts ('unsafe-inline' would be ignored).
+func addScriptHashes(csp string, hashes []string) string {
+	if len(hashes) == 0 {
+		return csp
+	}
+	directives := strings.Split(csp, ";")
+	scriptSrc, defaultSrc := -1, -1
+	for i, d := range directives {
+		fields := strings.Fields(d)
+		if len(fields) == 0 {
+			continue
+		}
+		switch strings.ToLower(fields[0]) {
+		case "script-src":
+			scriptSrc = i
+		case "default-src":
+			defaultSrc = i
+		}
+	}
+
+	src := ""
+	switch {
+	case scriptSrc >= 0:
+		src = directives[scriptSrc]
+	case defaultSrc >= 0:
+		src = "script-src " + strings.Join(strings.Fields(directives[defaultSrc])[1:], " ")
+		scriptSrc = len(directives)
+		directives = append(directives, "")
+	default:
+		return csp // scripts are not restricted
+	}
+	if strings.Contains(src, "'unsafe-inline'") {
+		return csp
+	}
+	directives[scriptSrc] = strings.TrimSpace(src) + " " + strings.Join(hashes, " ")
+	policy := make([]string, 0, len(directives))
+	for _, d := range directives {
+		if d = strings.TrimSpace(d); d != "" {
+			policy = append(policy, d)
+		}
+	}
+	return strings.Join(policy, "; ")
+}
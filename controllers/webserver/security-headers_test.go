@@ -0,0 +1,154 @@
+package webserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+	"github.com/tomasji/webid-operator/controllers/pages"
+)
+
+// scriptHash returns the CSP hash source of the inline script
+func scriptHash(script string) string {
+	sum := sha256.Sum256([]byte(script))
+	return "'sha256-" + base64.StdEncoding.EncodeToString(sum[:]) + "'"
+}
+
+var _ = Describe("securityHeaders", func() {
+	It("renders no headers if not configured", func() {
+		Expect(securityHeaders(&webidv1alpha1.WebServer{})).To(BeEmpty())
+	})
+
+	It("renders the defaults", func() {
+		web := &webidv1alpha1.WebServer{Spec: webidv1alpha1.WebServerSpec{SecurityHeaders: &webidv1alpha1.SecurityHeaders{}}}
+		Expect(securityHeaders(web)).To(Equal([]nginxHeader{
+			{Name: "X-Content-Type-Options", Value: "nosniff"},
+			{Name: "Strict-Transport-Security", Value: "max-age=31536000"},
+			{Name: cspHeader, Value: defaultCSP},
+			{Name: "X-Frame-Options", Value: defaultFrameOptions},
+			{Name: "Referrer-Policy", Value: defaultReferrerPolicy},
+			{Name: "Permissions-Policy", Value: defaultPermissionsPolicy},
+		}))
+	})
+
+	It("omits headers set empty", func() {
+		zero, empty := int64(0), ""
+		web := &webidv1alpha1.WebServer{Spec: webidv1alpha1.WebServerSpec{SecurityHeaders: &webidv1alpha1.SecurityHeaders{
+			HSTSMaxAge: &zero, ContentSecurityPolicy: &empty, FrameOptions: &empty,
+			ReferrerPolicy: &empty, PermissionsPolicy: &empty,
+		}}}
+		Expect(securityHeaders(web)).To(Equal([]nginxHeader{{Name: "X-Content-Type-Options", Value: "nosniff"}}))
+	})
+
+	It("includes subdomains in HSTS", func() {
+		maxAge := int64(600)
+		web := &webidv1alpha1.WebServer{Spec: webidv1alpha1.WebServerSpec{SecurityHeaders: &webidv1alpha1.SecurityHeaders{
+			HSTSMaxAge: &maxAge, HSTSIncludeSubDomains: true,
+		}}}
+		Expect(securityHeaders(web)).To(ContainElement(
+			nginxHeader{Name: "Strict-Transport-Security", Value: "max-age=600; includeSubDomains"}))
+	})
+})
+
+var _ = Describe("validateSecurityHeaders", func() {
+	DescribeTable("rejects the values breaking the nginx config",
+		func(change func(*webidv1alpha1.SecurityHeaders, *string), value string, valid bool) {
+			sh := &webidv1alpha1.SecurityHeaders{}
+			change(sh, &value)
+			err := validateSecurityHeaders(&webidv1alpha1.WebServer{Spec: webidv1alpha1.WebServerSpec{SecurityHeaders: sh}})
+			if valid {
+				Expect(err).NotTo(HaveOccurred())
+			} else {
+				Expect(err).To(HaveOccurred())
+			}
+		},
+		Entry("CSP", func(sh *webidv1alpha1.SecurityHeaders, v *string) { sh.ContentSecurityPolicy = v },
+			"default-src 'self'; img-src *", true),
+		Entry("line feed in CSP", func(sh *webidv1alpha1.SecurityHeaders, v *string) { sh.ContentSecurityPolicy = v },
+			"default-src 'self'\nadd_header X-Injected 1", false),
+		Entry("carriage return in CSP", func(sh *webidv1alpha1.SecurityHeaders, v *string) { sh.ContentSecurityPolicy = v },
+			"default-src 'self'\r", false),
+		Entry("nginx variable in CSP", func(sh *webidv1alpha1.SecurityHeaders, v *string) { sh.ContentSecurityPolicy = v },
+			"default-src $host", false),
+		Entry("line feed in Permissions-Policy", func(sh *webidv1alpha1.SecurityHeaders, v *string) { sh.PermissionsPolicy = v },
+			"camera=()\nmicrophone=()", false),
+	)
+
+	It("fails the reconciliation before the config is rendered", func() {
+		csp := "default-src 'self'\r\nX-Injected: 1"
+		web := &webidv1alpha1.WebServer{ObjectMeta: metav1.ObjectMeta{Namespace: "ns", Name: "web"},
+			Spec: webidv1alpha1.WebServerSpec{SecurityHeaders: &webidv1alpha1.SecurityHeaders{ContentSecurityPolicy: &csp}}}
+		r := newTestReconciler(web)
+		_, err := r.reconcileConfigCM(context.Background(), web, &instance{name: "web"})
+		Expect(err).To(HaveOccurred())
+		Expect(r.Get(context.Background(), types.NamespacedName{Namespace: "ns", Name: ConfigCMName("web")},
+			&corev1.ConfigMap{})).NotTo(Succeed())
+	})
+})
+
+var _ = Describe("addScriptHashes", func() {
+	hashes := []string{"'sha256-a'", "'sha256-b'"}
+
+	DescribeTable("adds the hashes to script-src",
+		func(csp string, hashes []string, expected string) {
+			Expect(addScriptHashes(csp, hashes)).To(Equal(expected))
+		},
+		Entry("no hashes", "default-src 'self'", nil, "default-src 'self'"),
+		Entry("existing script-src", "default-src 'self'; script-src 'self' cdn.example.com", hashes,
+			"default-src 'self'; script-src 'self' cdn.example.com 'sha256-a' 'sha256-b'"),
+		Entry("case insensitive directive", "SCRIPT-SRC 'self'", hashes, "SCRIPT-SRC 'self' 'sha256-a' 'sha256-b'"),
+		Entry("derived from default-src", "default-src 'self' data:; img-src *", hashes,
+			"default-src 'self' data:; img-src *; script-src 'self' data: 'sha256-a' 'sha256-b'"),
+		Entry("scripts not restricted", "img-src 'self'", hashes, "img-src 'self'"),
+		Entry("inline scripts allowed", "script-src 'self' 'unsafe-inline'", hashes, "script-src 'self' 'unsafe-inline'"),
+		Entry("inline scripts allowed by default-src", "default-src 'unsafe-inline'", hashes, "default-src 'unsafe-inline'"),
+		Entry("empty directives dropped", "default-src 'self';; script-src 'self';", hashes,
+			"default-src 'self'; script-src 'self' 'sha256-a' 'sha256-b'"),
+	)
+})
+
+var _ = Describe("fileHeaders", func() {
+	server := []nginxHeader{
+		{Name: "X-Content-Type-Options", Value: "nosniff"},
+		{Name: cspHeader, Value: "default-src 'self'"},
+	}
+
+	It("keeps the server headers of a page without inline scripts", func() {
+		Expect(fileHeaders(server, "index.html", pages.FileInfo{}, []byte("<p>hello</p>"))).To(BeNil())
+		Expect(fileHeaders(server, "app.js", pages.FileInfo{}, []byte("<script>x()</script>"))).To(BeNil())
+	})
+
+	It("adds hashes of the inline scripts once", func() {
+		contents := []byte(`<script>x()</script><script src="a.js"></script><script>x()</script><script>y()</script>`)
+		Expect(fileHeaders(server, "index.html", pages.FileInfo{}, contents)).To(Equal([]nginxHeader{
+			{Name: "X-Content-Type-Options", Value: "nosniff"},
+			{Name: cspHeader, Value: "default-src 'self'; script-src 'self' " + scriptHash("x()") + " " + scriptHash("y()")},
+		}))
+	})
+
+	It("hashes inline scripts of a file with an HTML content type", func() {
+		headers := fileHeaders(server, "page", pages.FileInfo{ContentType: "text/html"}, []byte("<script>x()</script>"))
+		Expect(headers).To(ContainElement(nginxHeader{Name: cspHeader,
+			Value: "default-src 'self'; script-src 'self' " + scriptHash("x()")}))
+	})
+
+	It("uses the policy of the page", func() {
+		headers := fileHeaders(server, "index.html", pages.FileInfo{CSP: "script-src 'none'"}, []byte("<p>hello</p>"))
+		Expect(headers).To(Equal([]nginxHeader{
+			{Name: "X-Content-Type-Options", Value: "nosniff"},
+			{Name: cspHeader, Value: "script-src 'none'"},
+		}))
+	})
+
+	It("does not add a policy if the server has none", func() {
+		Expect(fileHeaders(nil, "index.html", pages.FileInfo{}, []byte("<script>x()</script>"))).To(BeNil())
+	})
+})
@@ -15,14 +15,17 @@ import (
 	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
 )
 
-// reconcileService gets the service (NS+name is same as of the web resource)
-// - if not found, create it
-func (r *Reconciler) reconcileService(ctx context.Context, web *webidv1alpha1.WebServer) (*webidv1alpha1.WebServer, error) {
+// httpPort is the name of the nginx container port and of the service port
+const httpPort = "http"
+
+// reconcileService gets the service (NS is same as of the web resource, name is the instance name)
+// - if not found, create it, if it differs from spec.service, update it
+func (r *Reconciler) reconcileService(ctx context.Context, web *webidv1alpha1.WebServer, inst *instance) (*webidv1alpha1.WebServer, error) {
 	debug := log.FromContext(ctx).V(1).Info
-	nsName := types.NamespacedName{Namespace: web.Namespace, Name: web.Name}
+	nsName := types.NamespacedName{Namespace: web.Namespace, Name: inst.name}
 
 	// Get the service
-	debug("checking service", "name", web.Name)
+	debug("checking service", "name", inst.name)
 	service := &corev1.Service{}
 	if err := r.Get(ctx, nsName, service); err != nil {
 		// generic error
@@ -31,42 +34,137 @@ func (r *Reconciler) reconcileService(ctx context.Context, web *webidv1alpha1.We
 		}
 
 		// service not found - create it
-		if err = r.createService(ctx, web); err != nil {
+		if err = r.createService(ctx, web, inst); err != nil {
 			return r.failWithStatus(ctx, web, err, "Failed to create service")
 		}
 		return web, nil
 	}
 
 	// service found - check it and update it if needed
-	debug("service found", "name", web.Name)
+	debug("service found", "name", inst.name)
+	if serviceDiffers(web, service) {
+		if err := r.updateService(ctx, web, service); err != nil {
+			return r.failWithStatus(ctx, web, err, "Failed to update service")
+		}
+	}
+	if inst.name == web.Name {
+		web.Status.Address = ""
+		if service.Spec.Type == corev1.ServiceTypeLoadBalancer {
+			web.Status.Address = loadBalancerAddress(service.Status.LoadBalancer.Ingress)
+		}
+	}
 	return web, nil
 }
 
-// createService creates a service, set ownership to web
-func (r *Reconciler) createService(ctx context.Context, web *webidv1alpha1.WebServer) error {
-	const httpPort = "http"
-	const indexFileName = "index.html"
+// serviceSpec returns spec.service of the web server with defaults set
+func serviceSpec(web *webidv1alpha1.WebServer) webidv1alpha1.ServiceSpec {
+	spec := webidv1alpha1.ServiceSpec{}
+	if web.Spec.Service != nil {
+		spec = *web.Spec.Service
+	}
+	if spec.Type == "" {
+		spec.Type = corev1.ServiceTypeClusterIP
+	}
+	if spec.Port == 0 {
+		spec.Port = 80
+	}
+	if spec.SessionAffinity == "" {
+		spec.SessionAffinity = corev1.ServiceAffinityNone
+	}
+	return spec
+}
+
+// servicePorts returns the ports of the service, it is routed to the auth proxy if it is enabled
+func servicePorts(web *webidv1alpha1.WebServer, spec webidv1alpha1.ServiceSpec) []corev1.ServicePort {
+	return []corev1.ServicePort{
+		{
+			Name:       httpPort,
+			Port:       spec.Port,
+			TargetPort: targetPort(web),
+		},
+	}
+}
 
+// serviceDiffers returns true if type, port (or target port), session affinity or annotations of the service
+// are different than expected
+func serviceDiffers(web *webidv1alpha1.WebServer, service *corev1.Service) bool {
+	spec := serviceSpec(web)
+	if len(service.Spec.Ports) != 1 || service.Spec.Ports[0].Port != spec.Port ||
+		service.Spec.Ports[0].TargetPort != targetPort(web) {
+		return true
+	}
+	for k, v := range spec.Annotations {
+		if service.Annotations[k] != v {
+			return true
+		}
+	}
+	return service.Spec.Type != spec.Type || service.Spec.SessionAffinity != spec.SessionAffinity
+}
+
+// updateService updates type, port, session affinity and annotations of the service
+func (r *Reconciler) updateService(ctx context.Context, web *webidv1alpha1.WebServer, service *corev1.Service) error {
+	log := log.FromContext(ctx)
+	spec := serviceSpec(web)
+
+	log.Info("updating service", "name", service.Name)
+	nodePort := int32(0)
+	if len(service.Spec.Ports) == 1 && spec.Type != corev1.ServiceTypeClusterIP {
+		nodePort = service.Spec.Ports[0].NodePort
+	}
+	service.Spec.Type = spec.Type
+	service.Spec.Ports = servicePorts(web, spec)
+	service.Spec.Ports[0].NodePort = nodePort
+	service.Spec.SessionAffinity = spec.SessionAffinity
+	if spec.SessionAffinity == corev1.ServiceAffinityNone {
+		service.Spec.SessionAffinityConfig = nil
+	}
+	if len(spec.Annotations) > 0 && service.Annotations == nil {
+		service.Annotations = make(map[string]string)
+	}
+	for k, v := range spec.Annotations {
+		service.Annotations[k] = v
+	}
+	if err := r.Update(ctx, service); err != nil {
+		log.Error(err, "Failed to update service", "Service.Namespace", service.Namespace, "Service.Name", service.Name)
+		return err
+	}
+	return nil
+}
+
+// loadBalancerAddress returns the first IP or host name of the load balancer, empty if not assigned yet
+func loadBalancerAddress(ingress []corev1.LoadBalancerIngress) string {
+	for _, lb := range ingress {
+		if lb.IP != "" {
+			return lb.IP
+		}
+		if lb.Hostname != "" {
+			return lb.Hostname
+		}
+	}
+	return ""
+}
+
+// createService creates a service, set ownership to web
+func (r *Reconciler) createService(ctx context.Context, web *webidv1alpha1.WebServer, inst *instance) error {
 	log := log.FromContext(ctx)
+	spec := serviceSpec(web)
 	labels := map[string]string{
-		"app.kubernetes.io/name":    web.Name + "-nginx",
+		"app.kubernetes.io/name":    inst.name + "-nginx",
 		"app.kubernetes.io/part-of": "webid-operator",
 	}
 
 	service := &corev1.Service{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      web.Name,
-			Namespace: web.Namespace,
-			Labels:    labels,
+			Name:        inst.name,
+			Namespace:   web.Namespace,
+			Labels:      labels,
+			Annotations: spec.Annotations,
 		},
 		Spec: corev1.ServiceSpec{
-			Ports: []corev1.ServicePort{
-				{
-					Name: httpPort,
-					Port: 80,
-				},
-			},
-			Selector: r.selectorLabels(web.Name),
+			Type:            spec.Type,
+			Ports:           servicePorts(web, spec),
+			Selector:        r.selectorLabels(inst.name),
+			SessionAffinity: spec.SessionAffinity,
 		},
 	}
 
@@ -0,0 +1,68 @@
+package webserver
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+)
+
+var _ = Describe("Service", func() {
+	withService := func(spec *webidv1alpha1.ServiceSpec) *webidv1alpha1.WebServer {
+		return &webidv1alpha1.WebServer{Spec: webidv1alpha1.WebServerSpec{Service: spec}}
+	}
+
+	It("defaults to a ClusterIP Service on port 80", func() {
+		Expect(serviceSpec(withService(nil))).To(Equal(webidv1alpha1.ServiceSpec{
+			Type: corev1.ServiceTypeClusterIP, Port: 80, SessionAffinity: corev1.ServiceAffinityNone}))
+	})
+
+	It("routes the Service to the auth proxy if it is enabled", func() {
+		web := withService(nil)
+		Expect(servicePorts(web, serviceSpec(web))[0].TargetPort).To(Equal(intstr.FromString(httpPort)))
+		web.Spec.Auth = &webidv1alpha1.AuthSpec{OIDC: &webidv1alpha1.OIDCSpec{}}
+		Expect(servicePorts(web, serviceSpec(web))[0].TargetPort).To(Equal(intstr.FromString(authPort)))
+	})
+
+	DescribeTable("serviceDiffers",
+		func(spec *webidv1alpha1.ServiceSpec, change func(*corev1.Service), differs bool) {
+			web := withService(spec)
+			s := serviceSpec(web)
+			svc := &corev1.Service{Spec: corev1.ServiceSpec{Type: s.Type, Ports: servicePorts(web, s),
+				SessionAffinity: s.SessionAffinity}}
+			svc.Annotations = s.Annotations
+			change(svc)
+			Expect(serviceDiffers(web, svc)).To(Equal(differs))
+		},
+		Entry("same", nil, func(*corev1.Service) {}, false),
+		Entry("extra annotation", nil, func(svc *corev1.Service) {
+			svc.Annotations = map[string]string{"other": "x"}
+		}, false),
+		Entry("type", &webidv1alpha1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer}, func(svc *corev1.Service) {
+			svc.Spec.Type = corev1.ServiceTypeClusterIP
+		}, true),
+		Entry("port", &webidv1alpha1.ServiceSpec{Port: 8080}, func(svc *corev1.Service) {
+			svc.Spec.Ports[0].Port = 80
+		}, true),
+		Entry("target port", nil, func(svc *corev1.Service) {
+			svc.Spec.Ports[0].TargetPort = intstr.FromString(authPort)
+		}, true),
+		Entry("missing annotation", &webidv1alpha1.ServiceSpec{Annotations: map[string]string{"lb": "internal"}},
+			func(svc *corev1.Service) { svc.Annotations = nil }, true),
+		Entry("session affinity", &webidv1alpha1.ServiceSpec{SessionAffinity: corev1.ServiceAffinityClientIP},
+			func(svc *corev1.Service) { svc.Spec.SessionAffinity = corev1.ServiceAffinityNone }, true),
+	)
+
+	DescribeTable("loadBalancerAddress",
+		func(ingress []corev1.LoadBalancerIngress, expected string) {
+			Expect(loadBalancerAddress(ingress)).To(Equal(expected))
+		},
+		Entry("not assigned", nil, ""),
+		Entry("IP", []corev1.LoadBalancerIngress{{IP: "192.0.2.10", Hostname: "lb.example.com"}}, "192.0.2.10"),
+		Entry("host name", []corev1.LoadBalancerIngress{{Hostname: "lb.example.com"}}, "lb.example.com"),
+		Entry("first assigned", []corev1.LoadBalancerIngress{{}, {IP: "192.0.2.11"}}, "192.0.2.11"),
+	)
+})
@@ -0,0 +1,66 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webserver
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+	"github.com/tomasji/webid-operator/controllers/config"
+	"github.com/tomasji/webid-operator/controllers/pages"
+)
+
+func TestWebServer(t *testing.T) {
+	RegisterFailHandler(Fail)
+
+	RunSpecs(t, "WebServer Suite")
+}
+
+// testScheme returns the scheme with the core and webid types for the fake client
+func testScheme() *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	Expect(webidv1alpha1.AddToScheme(scheme)).To(Succeed())
+	return scheme
+}
+
+// testConfig returns the operator config with the defaults needed to render nginx config
+func testConfig() *config.Config {
+	return &config.Config{Resolver: "kube-dns.kube-system.svc.cluster.local", ClusterDomain: "cluster.local"}
+}
+
+// newTestReconciler returns a reconciler with a fake client holding the objects, and empty pages data
+func newTestReconciler(objs ...client.Object) *Reconciler {
+	return &Reconciler{
+		Client: fake.NewClientBuilder().WithScheme(testScheme()).WithObjects(objs...).Build(),
+		Scheme: testScheme(),
+		Cfg:    testConfig(),
+		DataProvider: &pages.Reconciler{
+			Data: make(map[types.NamespacedName]pages.PageData),
+			Info: make(map[types.NamespacedName]pages.PageInfo),
+		},
+	}
+}
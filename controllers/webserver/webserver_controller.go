@@ -30,12 +30,17 @@ import (
 	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
+	"github.com/tomasji/webid-operator/controllers/batcher"
 	"github.com/tomasji/webid-operator/controllers/config"
 	"github.com/tomasji/webid-operator/controllers/pages"
 )
@@ -46,17 +51,87 @@ type Reconciler struct {
 	Scheme       *runtime.Scheme
 	Cfg          *config.Config
 	DataProvider pages.DataProvider
+	batch        *batcher.Batcher
 }
 
 const (
-	typeAvailableWeb = "Available"
+	typeAvailableWeb   = "Available"
+	webServerFinalizer = "tomasji.github.com/finalizer"
 )
 
-type reconcileHelperFunc = func(ctx context.Context, web *webidv1alpha1.WebServer) (*webidv1alpha1.WebServer, error)
+type reconcileHelperFunc = func(ctx context.Context, web *webidv1alpha1.WebServer, inst *instance) (*webidv1alpha1.WebServer, error)
+
+// instance is a nginx deployment (with its config, data, service and ingress) serving pages of the web server,
+// it is either the main one, or the preview one serving also the draft pages
+type instance struct {
+	// name of the deployment, service and ingress
+	name string
+	// host of the ingress
+	host string
+	// key of the pages data in DataProvider
+	data types.NamespacedName
+	// name of the configMap with pages mounted by the deployment, either the data configMap or a release
+	dataCM string
+	// pages data and info, as taken from DataProvider (or from the Release configMap)
+	contents map[string][]byte
+	info     pages.PageInfo
+	// name of the pinned Release, whose configMap is served instead of the data configMap
+	release string
+	// redirects rendered into the nginx config
+	redirects []webidv1alpha1.Redirect
+	// proxies with an existing backend Service, rendered into the nginx config
+	proxies []webidv1alpha1.ProxySpec
+}
+
+// newInstance returns an instance serving data (taken from DataProvider) from a content-addressed data configMap
+func (r *Reconciler) newInstance(name, host string, data types.NamespacedName) *instance {
+	inst := &instance{name: name, host: host, data: data,
+		contents: r.DataProvider.GetData(data), info: r.DataProvider.GetInfo(data)}
+	inst.dataCM = DataCMName(name, pages.Hash(inst.contents, inst.info))
+	return inst
+}
+
+// instances returns the main instance of the web server and the preview one (if enabled)
+func (r *Reconciler) instances(ctx context.Context, web *webidv1alpha1.WebServer) ([]*instance, error) {
+	nsName := types.NamespacedName{Namespace: web.Namespace, Name: web.Name}
+	main := r.newInstance(web.Name, r.Cfg.IngressDomain, nsName)
+	if web.Spec.Release != "" {
+		if err := r.pinRelease(ctx, web, main); err != nil {
+			return nil, err
+		}
+	}
+
+	list := []*instance{main}
+	if web.Spec.Preview != nil {
+		list = append(list, r.previewInstance(web, r.Cfg.PreviewHost(web)))
+	}
+	redirects, err := r.listRedirects(ctx, web)
+	if err != nil {
+		return nil, err
+	}
+	proxies, err := r.availableProxies(ctx, web)
+	if err != nil {
+		return nil, err
+	}
+	for _, inst := range list {
+		inst.redirects = redirects
+		inst.proxies = proxies
+	}
+	return list, nil
+}
+
+// previewInstance returns the preview instance of the web server
+func (r *Reconciler) previewInstance(web *webidv1alpha1.WebServer, host string) *instance {
+	nsName := types.NamespacedName{Namespace: web.Namespace, Name: web.Name}
+	return r.newInstance(web.Name+"-preview", host, pages.PreviewKey(nsName))
+}
 
 //+kubebuilder:rbac:groups=webid.golang.betsys.com,resources=webservers,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=webid.golang.betsys.com,resources=webservers/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=webid.golang.betsys.com,resources=webservers/finalizers,verbs=update
+//+kubebuilder:rbac:groups=apps,resources=replicasets,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch
+//+kubebuilder:rbac:groups=gateway.networking.k8s.io,resources=httproutes,verbs=get;list;watch;create;update;patch;delete
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -71,21 +146,38 @@ func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Resu
 	log := log.FromContext(ctx)
 	debug := log.V(1).Info
 
+	// spec.access is validated first, so that an invalid rule is not rendered into the config;
+	// configMaps and the htpasswd secret go before the deployment, so that it is rolled out with up to date config and data
 	reconcileFuncs := []reconcileHelperFunc{
-		r.reconcileDeployment,
+		r.reconcileAccess,
 		r.reconcileConfigCM,
 		r.reconcileDataCM,
+		r.reconcileDeployment,
 		r.reconcileService,
-		r.reconcileIngress,
+		r.reconcileExposure,
 	}
 
 	// Get the WebServer object
 	web, err := r.getObj(ctx, req.NamespacedName)
 	if web == nil {
+		r.batch.Forget(req.NamespacedName)
 		return ctrl.Result{}, err
 	}
 	debug("Reconcile: got object:", "web", web)
 
+	// Handle deletion
+	if web.GetDeletionTimestamp() != nil {
+		return ctrl.Result{}, r.finalize(ctx, web)
+	}
+
+	// Add finalizer if it does not exist
+	if controllerutil.AddFinalizer(web, webServerFinalizer) {
+		if err = r.Update(ctx, web); err != nil {
+			log.Error(err, "Failed to update custom resource to add finalizer")
+			return ctrl.Result{}, err
+		}
+	}
+
 	// Let's just set the status as Unknown when no status are available
 	if web.Status.Conditions == nil || len(web.Status.Conditions) == 0 {
 		if web, err = r.setStatus(ctx, web, metav1.ConditionUnknown, "Starting reconciliation"); err != nil {
@@ -93,9 +185,29 @@ func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Resu
 		}
 	}
 
+	// Get all pages of the webserver, prepare data; the pending page changes are published now,
+	// changes coming while the data are prepared start a new batch
+	r.batch.Done(req.NamespacedName)
+	prepared, err := r.DataProvider.PrepareData(ctx, web)
+	if err != nil {
+		_, err = r.failWithStatus(ctx, web, err, "Failed to get web page data")
+		return ctrl.Result{}, err
+	}
+
 	// check / create / update dependent objects
-	for _, reconcileFunc := range reconcileFuncs {
-		if web, err = reconcileFunc(ctx, web); err != nil {
+	instances, err := r.instances(ctx, web)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	for _, inst := range instances {
+		for _, reconcileFunc := range reconcileFuncs {
+			if web, err = reconcileFunc(ctx, web, inst); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+	}
+	if web.Spec.Preview == nil {
+		if web, err = r.deletePreview(ctx, web); err != nil {
 			return ctrl.Result{}, err
 		}
 	}
@@ -103,13 +215,55 @@ func (r *Reconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Resu
 	// set status
 	meta.SetStatusCondition(&web.Status.Conditions, metav1.Condition{Type: "UpToDate", Status: metav1.ConditionTrue,
 		Reason: "PageChanged", Message: "Pages updated"})
+	if prepared.Changed {
+		web.Status.PagesHash = prepared.Hash
+	}
+	web.Status.Pages = prepared.Pages
+	web.Status.ErrorCodes = errorCodes(instances[0].info)
 	if web, err = r.setStatus(ctx, web, metav1.ConditionTrue, "Finished reconciliation"); err != nil {
 		return ctrl.Result{}, err
 	}
+
+	// requeue at the time a page gets published/expires, or templates are rendered with a new year
+	if prepared.Next > 0 {
+		debug("Reconcile: completed, requeue at the next page schedule transition", "after", prepared.Next)
+		return ctrl.Result{RequeueAfter: prepared.Next}, nil
+	}
 	debug("Reconcile: completed")
 	return ctrl.Result{}, nil
 }
 
+// finalize deletes or orphans the pages of the deleted webserver (see spec.pageDeletionPolicy),
+// forgets its data and removes the finalizer
+func (r *Reconciler) finalize(ctx context.Context, web *webidv1alpha1.WebServer) error {
+	log := log.FromContext(ctx)
+	nsName := types.NamespacedName{Namespace: web.Namespace, Name: web.Name}
+
+	if web.Spec.PageDeletionPolicy == webidv1alpha1.PageDeletionPolicyDelete {
+		list := &webidv1alpha1.PageList{}
+		if err := r.List(ctx, list, client.MatchingFields{pages.WebServerKey: nsName.String()}); err != nil {
+			return err
+		}
+		for i := range list.Items {
+			log.Info("Deleting Page of deleted WebServer", "namespace", web.Namespace, "name", list.Items[i].Name)
+			if err := r.Delete(ctx, &list.Items[i]); err != nil && !apierrors.IsNotFound(err) {
+				return err
+			}
+		}
+	}
+
+	r.DataProvider.Forget(nsName)
+	r.batch.Forget(nsName)
+	if controllerutil.RemoveFinalizer(web, webServerFinalizer) {
+		if err := r.Update(ctx, web); err != nil {
+			log.Error(err, "Failed to update custom resource to remove finalizer")
+			return err
+		}
+	}
+	log.V(1).Info("webserver finalized", "name", web.Name, "pageDeletionPolicy", web.Spec.PageDeletionPolicy)
+	return nil
+}
+
 // getObj retrieves webserver object, it returns:
 // - nil, nil -> stop reconciliation (obj deleted)
 // - nil, error -> stop reconciliation (requeue)
@@ -169,15 +323,71 @@ func (r *Reconciler) failWithStatus(ctx context.Context, web *webidv1alpha1.WebS
 }
 
 // SetupWithManager sets up the controller with the Manager.
+// Create a new index "spec.release" in the cache, so that web servers are reconciled when their Release is ready,
+// "spec.access.secrets", so that htpasswd files are regenerated when the basic auth secrets change,
+// "spec.proxies.service", so that proxies are rendered when their backend Service appears,
+// and Redirect "spec.webserver", so that the redirects are rendered into the nginx config.
+// Pages (and ConfigMaps/Secrets referenced by them, PageGrants) are watched, their changes are batched per web server
+// and the web server is enqueued by the batcher source when they are due (other events are not delayed).
+// The Gateway API HTTPRoutes are owned only if their CRD is installed at the start.
 func (r *Reconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
+	r.batch = batcher.New(r.Cfg.PageQuietPeriod, r.Cfg.PageMaxDelay)
+
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &webidv1alpha1.WebServer{}, releaseKey,
+		func(rawObj client.Object) []string {
+			web := rawObj.(*webidv1alpha1.WebServer)
+			return []string{web.Spec.Release}
+		}); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &webidv1alpha1.Redirect{}, redirectWebServerKey,
+		func(rawObj client.Object) []string {
+			return []string{rawObj.(*webidv1alpha1.Redirect).Spec.WebServer}
+		}); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &webidv1alpha1.WebServer{}, accessSecretKey,
+		func(rawObj client.Object) []string {
+			var names []string
+			for _, name := range accessSecrets(rawObj.(*webidv1alpha1.WebServer)) {
+				names = append(names, name)
+			}
+			return names
+		}); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(context.Background(), &webidv1alpha1.WebServer{}, proxyServiceKey,
+		func(rawObj client.Object) []string {
+			return proxyServices(rawObj.(*webidv1alpha1.WebServer))
+		}); err != nil {
+		return err
+	}
+
+	bld := ctrl.NewControllerManagedBy(mgr).
 		For(&webidv1alpha1.WebServer{}).
+		Watches(&source.Kind{Type: &webidv1alpha1.Release{}}, handler.EnqueueRequestsFromMapFunc(r.webServersOfRelease)).
+		Watches(&source.Kind{Type: &webidv1alpha1.Page{}}, r.batched(r.webServerOfPage),
+			builder.WithPredicates(pageChangedPredicate())).
+		Watches(&source.Kind{Type: &corev1.ConfigMap{}}, r.batched(r.webServersReferencing(pages.ConfigMapKey))).
+		Watches(&source.Kind{Type: &corev1.Secret{}}, r.batched(r.webServersReferencing(pages.SecretKey))).
+		Watches(&source.Kind{Type: &corev1.Secret{}}, handler.EnqueueRequestsFromMapFunc(r.webServersOfAuthSecret)).
+		Watches(&source.Kind{Type: &webidv1alpha1.PageGrant{}}, r.batched(r.webServersOfGrant)).
+		Watches(&source.Kind{Type: &webidv1alpha1.Redirect{}}, handler.EnqueueRequestsFromMapFunc(r.webServerOfRedirect)).
+		Watches(&source.Kind{Type: &corev1.Service{}}, handler.EnqueueRequestsFromMapFunc(r.webServersOfProxyService)).
+		Watches(r.batch.Source(), &handler.EnqueueRequestForObject{}).
 		Owns(&appsv1.Deployment{}).
 		Owns(&corev1.ConfigMap{}).
 		Owns(&corev1.Service{}).
 		Owns(&netv1.Ingress{}).
-		WithEventFilter(webServerEventFilter()).
-		Complete(r)
+		WithEventFilter(webServerEventFilter())
+
+	// HTTPRoutes are watched only if the Gateway API is installed (see spec.exposure)
+	if _, err := mgr.GetRESTMapper().RESTMapping(httpRouteGVK.GroupKind(), httpRouteGVK.Version); err == nil {
+		bld = bld.Owns(newHTTPRoute())
+	} else if !meta.IsNoMatchError(err) {
+		return err
+	}
+	return bld.Complete(r)
 }
 
 func webServerEventFilter() predicate.Predicate {
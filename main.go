@@ -35,7 +35,9 @@ import (
 
 	webidv1alpha1 "github.com/tomasji/webid-operator/api/v1alpha1"
 	"github.com/tomasji/webid-operator/controllers/config"
+	"github.com/tomasji/webid-operator/controllers/gitsource"
 	"github.com/tomasji/webid-operator/controllers/pages"
+	"github.com/tomasji/webid-operator/controllers/release"
 	"github.com/tomasji/webid-operator/controllers/webserver"
 	//+kubebuilder:scaffold:imports
 )
@@ -85,7 +87,9 @@ func main() {
 	pageSvc := pages.Reconciler{
 		Client: mgr.GetClient(),
 		Scheme: mgr.GetScheme(),
+		Cfg:    cfg,
 		Data:   make(map[types.NamespacedName]pages.PageData),
+		Info:   make(map[types.NamespacedName]pages.PageInfo),
 	}
 	if err = (&pageSvc).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Page")
@@ -101,6 +105,21 @@ func main() {
 		setupLog.Error(err, "unable to create controller", "controller", "WebServer")
 		os.Exit(1)
 	}
+	if err = (&gitsource.Reconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "GitSource")
+		os.Exit(1)
+	}
+	if err = (&release.Reconciler{
+		Client:       mgr.GetClient(),
+		Scheme:       mgr.GetScheme(),
+		DataProvider: &pageSvc,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "Release")
+		os.Exit(1)
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {